@@ -0,0 +1,71 @@
+package tisasm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// commandLine is the file of symbols given in Options.Defines.
+const commandLine = "<command line>"
+
+// Options tweaks how Assemble works. The zero value is ready to use.
+type Options struct {
+	// IncludeDirs are searched in order for files named by .include that
+	// are not next to the file including them.
+	IncludeDirs []string
+	// Defines are constants set before the source is read, usually to be
+	// tested by .if and .ifdef.
+	Defines map[string]uint16
+}
+
+// Assemble reads the whole source and assembles it in memory. The program
+// is returned even when there are errors, so the diagnostics can be shown
+// using its sources, but it must not be written if HasErrors is true.
+func Assemble(name string, src io.Reader, opts Options) (*Program, []Diagnostic) {
+	source, err := ioutil.ReadAll(src)
+	if err != nil {
+		return &Program{}, []Diagnostic{newDiagnostic(name, "%s", err)}
+	}
+	parser := NewParser(newSourceScanner(name, source))
+	parser.includeDirs = opts.IncludeDirs
+	parser.program.Files = []string{name}
+	parser.program.Sources[name] = source
+	for define, value := range opts.Defines {
+		parser.program.Symbols[define] = Symbol{
+			Name:  define,
+			Kind:  SymbolConstant,
+			Value: value,
+			Token: Token{File: commandLine, Literal: define},
+		}
+	}
+	return parser.Parse()
+}
+
+func newSourceScanner(name string, source []byte) Scanner {
+	return NewFileScanner(name, bufio.NewReader(bytes.NewReader(source)))
+}
+
+// ParseNumber reads a number written like in the source, for values given
+// out of it, like in the command line: decimal, hexadecimal after 0x or $,
+// or binary after 0b.
+func ParseNumber(text string) (uint16, error) {
+	digits, base := text, 10
+	switch {
+	case strings.HasPrefix(text, "$"):
+		digits, base = text[1:], 16
+	case strings.HasPrefix(text, "0x"), strings.HasPrefix(text, "0X"):
+		digits, base = text[2:], 16
+	case strings.HasPrefix(text, "0b"), strings.HasPrefix(text, "0B"):
+		digits, base = text[2:], 2
+	}
+	number, err := strconv.ParseUint(digits, base, 16)
+	if err != nil {
+		return 0, fmt.Errorf("expected %s to be a number under 65536", text)
+	}
+	return uint16(number), nil
+}
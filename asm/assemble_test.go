@@ -0,0 +1,33 @@
+package tisasm
+
+import "testing"
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		text  string
+		value uint16
+		ok    bool
+	}{
+		{"0", 0, true},
+		{"010", 10, true},
+		{"65535", 65535, true},
+		{"$0200", 0x0200, true},
+		{"$ff", 0xff, true},
+		{"0x4100", 0x4100, true},
+		{"0XFF", 0xff, true},
+		{"0b101", 5, true},
+		{"65536", 0, false},
+		{"1_000", 0, false},
+		{"0o17", 0, false},
+		{"0x", 0, false},
+		{"$", 0, false},
+		{"-1", 0, false},
+		{"ten", 0, false},
+	}
+	for _, test := range tests {
+		value, err := ParseNumber(test.text)
+		if (err == nil) != test.ok || value != test.value {
+			t.Errorf("%s: got %d, %v, want %d", test.text, value, err, test.value)
+		}
+	}
+}
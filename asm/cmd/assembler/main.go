@@ -1,39 +1,179 @@
 package main
 
 import (
-	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"tisasm"
 )
 
+const stdinPath = "-"
+
+// pathList is a flag that can be given many times.
+type pathList []string
+
+func (list *pathList) String() string {
+	return strings.Join(*list, string(os.PathListSeparator))
+}
+
+func (list *pathList) Set(path string) error {
+	*list = append(*list, path)
+	return nil
+}
+
+// defineList is a flag of NAME=value constants that can be given many
+// times. A NAME without value is defined as 1.
+type defineList map[string]uint16
+
+func (defines defineList) String() string {
+	names := make([]string, 0, len(defines))
+	for name, value := range defines {
+		names = append(names, fmt.Sprintf("%s=%d", name, value))
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+func (defines defineList) Set(define string) error {
+	name, value := define, "1"
+	if equals := strings.Index(define, "="); equals >= 0 {
+		name, value = define[:equals], define[equals+1:]
+	}
+	if name == "" {
+		return errors.New("expected NAME=value")
+	}
+	number, err := tisasm.ParseNumber(value)
+	if err != nil {
+		return err
+	}
+	defines[name] = number
+	return nil
+}
+
+var includeDirs pathList
+var defines = make(defineList)
+var listingPath string
+var symbolsPath string
+var debugPath string
+var embedDebug bool
+
+func init() {
+	flag.Var(&includeDirs, "I", "search `dir` for included files (can be repeated)")
+	flag.Var(defines, "D", "define a constant as `NAME=value`, or NAME as 1 (can be repeated)")
+	flag.StringVar(&symbolsPath, "sym", "", "write the symbol file to `file` (by default, next to the ROM as .sym)")
+	flag.BoolVar(&embedDebug, "g", false, "embed the debug info in the ROM, in a section that the loader skips")
+	flag.StringVar(&debugPath, "dbg", "", "write the debug info to `file`")
+	flag.StringVar(&listingPath, "listing", "", "write the listing of the source, with addresses and bytes, to `file`")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-I dir]... [-D NAME=value]... [-g] [-dbg file] [-sym file] [-listing file] file.asm\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Use - as file to read from stdin and write the ROM to stdout.")
+		flag.PrintDefaults()
+	}
+}
+
 func getSourcePath() string {
-	if len(os.Args) != 2 {
-		log.Fatalln("You should provide an assembly file")
+	if flag.NArg() != 1 {
+		log.Fatalln("You should provide an assembly file (or - to read it from stdin)")
+	}
+	return flag.Arg(0)
+}
+
+// generateOutputFile replaces the extension of the source, so the files
+// written never overwrite it.
+func generateOutputFile(inputPath string, extension string) string {
+	return strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + extension
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	return os.Args[1]
 }
 
-func generateOutputFile(inputPath string) string {
-	return strings.Replace(inputPath, ".asm", ".rom", 1)
+func exitOnDiagnostics(diags []tisasm.Diagnostic, sources tisasm.SourceFiles) {
+	for _, diag := range diags {
+		tisasm.WriteDiagnostic(os.Stderr, diag, sources)
+	}
+	count := tisasm.CountErrors(diags)
+	if count > 0 {
+		fmt.Fprintf(os.Stderr, "%d error(s) found, no ROM written\n", count)
+		os.Exit(1)
+	}
 }
 
-func scannerFromFile(file *os.File) tisasm.Scanner {
-	return tisasm.NewFileScanner(bufio.NewReader(file))
+func assemble(path string, src io.Reader) *tisasm.Program {
+	program, diags := tisasm.Assemble(path, src, tisasm.Options{
+		IncludeDirs: includeDirs,
+		Defines:     defines,
+	})
+	exitOnDiagnostics(diags, program.Sources)
+	if listingPath != "" {
+		writeListing(program)
+	}
+	if debugPath != "" {
+		writeDebugInfo(program)
+	}
+	return program
+}
+
+func writeDebugInfo(program *tisasm.Program) {
+	file, err := tisasm.CreateFile(debugPath)
+	exitOnError(err)
+	defer file.Close()
+	_, err = program.DebugInfo().WriteTo(file)
+	exitOnError(err)
+}
+
+func writeROM(program *tisasm.Program, out io.Writer) {
+	if embedDebug {
+		exitOnError(program.WriteDebugROM(out))
+		return
+	}
+	exitOnError(program.WriteROM(out))
+}
+
+func writeListing(program *tisasm.Program) {
+	file, err := tisasm.CreateFile(listingPath)
+	exitOnError(err)
+	defer file.Close()
+	exitOnError(program.WriteListing(file))
+}
+
+func writeSymbols(program *tisasm.Program, path string) {
+	file, err := tisasm.CreateFile(path)
+	exitOnError(err)
+	defer file.Close()
+	exitOnError(program.WriteSymbols(file))
 }
 
 func main() {
+	flag.Parse()
 	path := getSourcePath()
-	file := tisasm.OpenFile(path)
+	if path == stdinPath {
+		program := assemble("<stdin>", os.Stdin)
+		if symbolsPath != "" {
+			writeSymbols(program, symbolsPath)
+		}
+		writeROM(program, os.Stdout)
+		return
+	}
+	file, err := tisasm.OpenFile(path)
+	exitOnError(err)
 	defer file.Close()
-	outputFile := tisasm.CreateFile(generateOutputFile(path))
+	program := assemble(path, file)
+	if symbolsPath == "" {
+		symbolsPath = generateOutputFile(path, ".sym")
+	}
+	writeSymbols(program, symbolsPath)
+	outputFile, err := tisasm.CreateFile(generateOutputFile(path, ".rom"))
+	exitOnError(err)
 	defer outputFile.Close()
-	tagReader := tisasm.NewTagReader(scannerFromFile(file))
-	tags := tagReader.GetTags()
-	fmt.Println(tags)
-	file.Seek(0, 0)
-	parser := tisasm.NewParser(scannerFromFile(file), outputFile, tags)
-	parser.Parse()
+	writeROM(program, outputFile)
 }
@@ -1,21 +1,149 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"tisasm"
 )
 
+// addressFlag is an address written as in the source: decimal, $hex,
+// 0xhex or 0bbinary.
+type addressFlag struct {
+	value uint16
+	set   bool
+}
+
+func (address *addressFlag) String() string {
+	return fmt.Sprintf("$%04x", address.value)
+}
+
+func (address *addressFlag) Set(text string) error {
+	number, err := tisasm.ParseNumber(text)
+	if err != nil {
+		return fmt.Errorf("expected %s to be an address under $10000", text)
+	}
+	address.value = number
+	address.set = true
+	return nil
+}
+
+var symbolsPath string
+var debugPath string
+var reassemble bool
+var followFlow bool
+var rawInput bool
+var hexInput bool
+var base addressFlag
+var start addressFlag
+var end addressFlag
+
+func init() {
+	flag.StringVar(&symbolsPath, "sym", "", "write the tags of the symbol `file` written by tisasm")
+	flag.StringVar(&debugPath, "dbg", "", "write the source lines and tags of the debug info `file` written by tisasm")
+	flag.BoolVar(&reassemble, "reassemble", false, "write source code that tisasm assembles into the same ROM, with labels for jumps")
+	flag.BoolVar(&followFlow, "flow", false, "decode only the code reached from the origin following jumps, calls and interrupt vectors, and the rest as .byte")
+	flag.BoolVar(&rawInput, "raw", false, "read the file as raw memory loaded from -base, instead of a ROM")
+	flag.BoolVar(&hexInput, "hex", false, "read the file as the memory rows of the status of the console, instead of a ROM")
+	flag.Var(&base, "base", "`address` where the raw memory is loaded (default $0000)")
+	flag.Var(&start, "start", "first `address` of the memory to decode (default the start of the memory)")
+	flag.Var(&end, "end", "last `address` of the memory to decode (default the end of the memory)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-reassemble] [-flow] [-sym file.sym] [-dbg file.dbg] file.rom\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [-raw [-base addr] | -hex] [-start addr] [-end addr] [options] file\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
 func main() {
-	binaryFile := tisasm.OpenFile(getSourcePath())
+	flag.Parse()
+	path := getSourcePath()
+	binaryFile, err := tisasm.OpenFile(path)
+	exitOnError(err)
 	defer binaryFile.Close()
-	diassembler := tisasm.NewDiassembler(binaryFile)
-	diassembler.Diasemble()
+	formatter := tisasm.NewTextFormatter()
+	if symbolsPath != "" {
+		formatter.UseSymbols(readSymbols(symbolsPath))
+	}
+	if debugPath != "" {
+		formatter.UseDebugInfo(readDebugInfo(debugPath))
+	}
+	diassembler := tisasm.NewDiassembler(path, binaryFile)
+	if followFlow {
+		diassembler.FollowControlFlow()
+	}
+	dis, diags := diasemble(diassembler)
+	if reassemble {
+		exitOnError(formatter.WriteSource(os.Stdout, dis))
+	} else {
+		exitOnError(formatter.Write(os.Stdout, dis))
+	}
+	for _, diag := range diags {
+		fmt.Fprintln(os.Stderr, diag)
+	}
+	if tisasm.HasErrors(diags) {
+		os.Exit(1)
+	}
+}
+
+// diasemble reads the file as the flags tell: a ROM, or a memory dump of
+// which only the range is decoded.
+func diasemble(diassembler *tisasm.Diassembler) (*tisasm.Disassembly, []tisasm.Diagnostic) {
+	isDump := rawInput || hexInput
+	if rawInput && hexInput {
+		log.Fatalln("-raw and -hex cannot be used together")
+	}
+	if !isDump && (base.set || start.set || end.set) {
+		log.Fatalln("-base, -start and -end need -raw or -hex")
+	}
+	if base.set && !rawInput {
+		log.Fatalln("-base needs -raw, hex dumps have the address of each row")
+	}
+	if start.set || end.set {
+		first, last := start.value, end.value
+		if !end.set {
+			last = 0xffff
+		}
+		diassembler.DecodeRange(first, last)
+	}
+	switch {
+	case rawInput:
+		return diassembler.DiasembleRaw(base.value)
+	case hexInput:
+		return diassembler.DiasembleHexDump()
+	}
+	return diassembler.Diasemble()
+}
+
+func readSymbols(path string) []tisasm.Symbol {
+	file, err := tisasm.OpenFile(path)
+	exitOnError(err)
+	defer file.Close()
+	symbols, err := tisasm.ReadSymbols(path, file)
+	exitOnError(err)
+	return symbols
+}
+
+func readDebugInfo(path string) tisasm.DebugInfo {
+	file, err := tisasm.OpenFile(path)
+	exitOnError(err)
+	defer file.Close()
+	info, err := tisasm.ReadDebugInfo(path, file)
+	exitOnError(err)
+	return info
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
 
 func getSourcePath() string {
-	if len(os.Args) != 2 {
-		log.Fatalln("You should provide an assembly file")
+	if flag.NArg() != 1 {
+		log.Fatalln("You should provide a ROM file")
 	}
-	return os.Args[1]
+	return flag.Arg(0)
 }
@@ -0,0 +1,238 @@
+// Command isagen generates the instruction table of the assembler and the
+// opcodes of the emulator from isa.txt, so both always agree. With -check
+// it only tells if the generated files are outdated, or if the emulator
+// does not handle some instruction.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// instruction is a line of the spec.
+type instruction struct {
+	mnemonic  string
+	opcode    byte
+	operands  []string
+	semantics string
+	group     string
+	line      int
+}
+
+// operandKinds are the operand names of the spec, and the OperandKind of
+// the assembler that each one is.
+var operandKinds = map[string]string{
+	"register": "OperandRegister",
+	"number":   "OperandNumber",
+	"address":  "OperandAddress",
+}
+
+var (
+	specPath   = flag.String("spec", "isa.txt", "read the instruction set from `file`")
+	goPath     = flag.String("go", "isa_table.go", "write the Go instruction table to `file`")
+	headerPath = flag.String("c", "../cpu/opcodes.h", "write the C opcodes to `file`")
+	cpuPath    = flag.String("cpu", "../cpu/cpu.c", "check that the emulator `file` handles every opcode")
+	check      = flag.Bool("check", false, "do not write anything, fail if the generated files are outdated")
+)
+
+func main() {
+	flag.Parse()
+	spec, err := readSpec(*specPath)
+	exitOnError(err)
+	table, err := goTable(spec)
+	exitOnError(err)
+	header := cHeader(spec)
+	if !*check {
+		exitOnError(ioutil.WriteFile(*goPath, table, 0644))
+		exitOnError(ioutil.WriteFile(*headerPath, header, 0644))
+		return
+	}
+	problems := checkGenerated(*goPath, table)
+	problems = append(problems, checkGenerated(*headerPath, header)...)
+	problems = append(problems, checkEmulator(*cpuPath, spec)...)
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stderr, problem)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func readSpec(path string) ([]instruction, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	spec := []instruction{}
+	mnemonics := make(map[string]int)
+	opcodes := make(map[byte]int)
+	group := ""
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "" || strings.HasPrefix(text, "#"):
+			continue
+		case strings.HasPrefix(text, "["):
+			group = strings.Trim(text, "[]")
+			continue
+		}
+		ins, err := parseInstruction(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, err)
+		}
+		if previous, ok := mnemonics[ins.mnemonic]; ok {
+			return nil, fmt.Errorf("%s:%d: %s is already declared at line %d", path, line, ins.mnemonic, previous)
+		}
+		if previous, ok := opcodes[ins.opcode]; ok {
+			return nil, fmt.Errorf("%s:%d: opcode 0x%02x is already used at line %d", path, line, ins.opcode, previous)
+		}
+		mnemonics[ins.mnemonic] = line
+		opcodes[ins.opcode] = line
+		ins.group = group
+		ins.line = line
+		spec = append(spec, ins)
+	}
+	return spec, scanner.Err()
+}
+
+var mnemonicPattern = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+// parseInstruction parses "mnemonic opcode operand... ; semantics".
+func parseInstruction(text string) (instruction, error) {
+	ins := instruction{}
+	if semicolon := strings.Index(text, ";"); semicolon >= 0 {
+		ins.semantics = strings.TrimSpace(text[semicolon+1:])
+		text = text[:semicolon]
+	}
+	fields := strings.Fields(text)
+	if len(fields) < 2 {
+		return ins, fmt.Errorf("expected mnemonic and opcode")
+	}
+	ins.mnemonic = fields[0]
+	if !mnemonicPattern.MatchString(ins.mnemonic) {
+		return ins, fmt.Errorf("mnemonic %s must be lowercase letters and digits", ins.mnemonic)
+	}
+	opcode, err := strconv.ParseUint(fields[1], 0, 8)
+	if err != nil {
+		return ins, fmt.Errorf("opcode %s of %s must be a byte", fields[1], ins.mnemonic)
+	}
+	ins.opcode = byte(opcode)
+	for _, operand := range fields[2:] {
+		if _, ok := operandKinds[operand]; !ok {
+			return ins, fmt.Errorf("unknown operand %s of %s, it must be register, number or address", operand, ins.mnemonic)
+		}
+	}
+	ins.operands = fields[2:]
+	return ins, nil
+}
+
+func goTable(spec []instruction) ([]byte, error) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by isagen from %s. DO NOT EDIT.\n\n", *specPath)
+	fmt.Fprintln(&out, "package tisasm")
+	fmt.Fprintln(&out)
+	fmt.Fprintln(&out, "var instructions []Instruction = []Instruction{")
+	group := ""
+	for i, ins := range spec {
+		if ins.group != group {
+			if i > 0 {
+				fmt.Fprintln(&out)
+			}
+			fmt.Fprintf(&out, "// %s\n", ins.group)
+			group = ins.group
+		}
+		kinds := make([]string, len(ins.operands))
+		for j, operand := range ins.operands {
+			kinds[j] = operandKinds[operand]
+		}
+		fmt.Fprintf(&out, "{\nLiteral: %q,", ins.mnemonic)
+		if ins.semantics != "" {
+			fmt.Fprintf(&out, " // %s", ins.semantics)
+		}
+		fmt.Fprintf(&out, "\nOpCode: 0x%02x,\n", ins.opcode)
+		if len(kinds) == 0 {
+			fmt.Fprintln(&out, "Operands: nil,")
+		} else {
+			fmt.Fprintf(&out, "Operands: []OperandKind{%s},\n", strings.Join(kinds, ", "))
+		}
+		fmt.Fprintln(&out, "},")
+	}
+	fmt.Fprintln(&out, "}")
+	return format.Source(out.Bytes())
+}
+
+func cHeader(spec []instruction) []byte {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by isagen from asm/%s. DO NOT EDIT.\n\n", *specPath)
+	fmt.Fprintln(&out, "#ifndef tiscpu_opcodes_h")
+	fmt.Fprintln(&out, "#define tiscpu_opcodes_h")
+	group := ""
+	for _, ins := range spec {
+		if ins.group != group {
+			fmt.Fprintf(&out, "\n// %s\n", ins.group)
+			group = ins.group
+		}
+		fmt.Fprintf(&out, "#define %s\t0x%02x", cName(ins), ins.opcode)
+		if ins.semantics != "" {
+			fmt.Fprintf(&out, "\t// %s", ins.semantics)
+		}
+		fmt.Fprintln(&out)
+	}
+	fmt.Fprintln(&out)
+	fmt.Fprintln(&out, "#endif")
+	return out.Bytes()
+}
+
+func cName(ins instruction) string {
+	return "OP_" + strings.ToUpper(ins.mnemonic)
+}
+
+func checkGenerated(path string, generated []byte) []string {
+	current, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if !bytes.Equal(current, generated) {
+		return []string{fmt.Sprintf("%s is outdated, run go generate in asm/", path)}
+	}
+	return nil
+}
+
+var opcodeDefine = regexp.MustCompile(`(?m)^\s*#define\s+(OP_\w+)`)
+
+// checkEmulator tells if the emulator defines its own opcodes instead of
+// using opcodes.h, or if it does not execute some instruction.
+func checkEmulator(path string, spec []instruction) []string {
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	problems := []string{}
+	for _, define := range opcodeDefine.FindAllSubmatch(source, -1) {
+		problems = append(problems, fmt.Sprintf("%s defines %s, opcodes must only be declared in %s", path, define[1], *specPath))
+	}
+	for _, ins := range spec {
+		handled := regexp.MustCompile(`\bcase\s+` + cName(ins) + `\s*:`)
+		if !handled.Match(source) {
+			problems = append(problems, fmt.Sprintf("%s does not execute %s (%s:%d)", path, ins.mnemonic, *specPath, ins.line))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+// The test runs from asm/cmd/isagen, while the default paths are relative
+// to asm/, where go generate runs. The default spec path is kept, since
+// it is written in the generated files.
+const asmDir = "../../"
+
+func TestGeneratedFilesMatchSpec(t *testing.T) {
+	spec, err := readSpec(asmDir + *specPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := goTable(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range checkGenerated(asmDir+*goPath, table) {
+		t.Error(problem)
+	}
+	for _, problem := range checkGenerated(asmDir+*headerPath, cHeader(spec)) {
+		t.Error(problem)
+	}
+}
+
+func TestEmulatorExecutesSpec(t *testing.T) {
+	spec, err := readSpec(asmDir + *specPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range checkEmulator(asmDir+*cpuPath, spec) {
+		t.Error(problem)
+	}
+}
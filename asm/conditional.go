@@ -0,0 +1,102 @@
+package tisasm
+
+// conditional is an .if block whose tokens are being assembled.
+type conditional struct {
+	directive Token
+	inElse    bool
+}
+
+func isConditionalStart(token Token) bool {
+	return isDirective(token, ".if") || isDirective(token, ".ifdef") || isDirective(token, ".ifndef")
+}
+
+// parseIf evaluates the condition of the directive. If it is false, the
+// block is skipped without being parsed, so tags inside it are not defined.
+func (prs *Parser) parseIf(directive Token) {
+	active := false
+	prs.parseStatement(directive, func(directive Token) {
+		active = prs.condition(directive)
+	})
+	if !active && isDirective(prs.skipConditional(directive, true), ".endif") {
+		return
+	}
+	prs.conditionals = append(prs.conditionals, conditional{directive, !active})
+}
+
+func (prs *Parser) condition(directive Token) bool {
+	if directive.Literal == ".if" {
+		return prs.immediateValue(prs.scan(), 2) != 0
+	}
+	name := prs.scan()
+	if !name.IsType(TokenInstruction) || !isSameLine(name, directive) {
+		prs.failf(name, "Expected name after %s", directive.Literal)
+	}
+	_, isSymbol := prs.program.Symbols[name.Literal]
+	_, isMacro := prs.macros[name.Literal]
+	return (isSymbol || isMacro) == (directive.Literal == ".ifdef")
+}
+
+// parseElse is found at the end of a block that was assembled, so the
+// .else block is skipped.
+func (prs *Parser) parseElse(directive Token) {
+	current := prs.currentConditional(directive)
+	if current.inElse {
+		prs.failf(directive, "Found a second .else for %s at %s", current.directive.Literal, current.directive.position())
+	}
+	prs.conditionals = prs.conditionals[:len(prs.conditionals)-1]
+	prs.skipConditional(current.directive, false)
+}
+
+func (prs *Parser) parseEndif(directive Token) {
+	prs.currentConditional(directive)
+	prs.conditionals = prs.conditionals[:len(prs.conditionals)-1]
+}
+
+// currentConditional returns the innermost block, that must be in the
+// same file or macro expansion as directive.
+func (prs *Parser) currentConditional(directive Token) conditional {
+	last := len(prs.conditionals) - 1
+	if last < 0 || !isSameSource(prs.conditionals[last].directive, directive) {
+		prs.failf(directive, "Found %s without .if", directive.Literal)
+	}
+	return prs.conditionals[last]
+}
+
+// skipConditional skips tokens until the .endif that closes the
+// directive, or until its .else if allowElse is true. It returns the
+// token where it stopped.
+func (prs *Parser) skipConditional(directive Token, allowElse bool) Token {
+	depth := 0
+	for {
+		token := prs.scan()
+		if token.IsType(TokenEof) || !isSameSource(token, directive) {
+			prs.unread(token)
+			prs.failf(directive, "Expected .endif to close %s", directive.Literal)
+		}
+		switch {
+		case isConditionalStart(token):
+			depth++
+		case isDirective(token, ".endif") && depth == 0:
+			return token
+		case isDirective(token, ".endif"):
+			depth--
+		case isDirective(token, ".else") && depth == 0 && allowElse:
+			return token
+		case isDirective(token, ".else") && depth == 0:
+			prs.diags = append(prs.diags, newTokenDiagnostic(token, "Found a second .else for %s at %s", directive.Literal, directive.position()))
+		}
+	}
+}
+
+// checkConditionals reports the blocks left open at the end of the file.
+func (prs *Parser) checkConditionals() {
+	for _, open := range prs.conditionals {
+		prs.diags = append(prs.diags, newTokenDiagnostic(open.directive, "Expected .endif to close %s", open.directive.Literal))
+	}
+}
+
+// isSameSource tells if both tokens were read from the same file, and
+// from the same macro expansion.
+func isSameSource(a, b Token) bool {
+	return a.File == b.File && a.Expansion == b.Expansion
+}
@@ -0,0 +1,99 @@
+package tisasm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConditionalAssembly(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		defines map[string]uint16
+		code    []byte
+		defined []string
+		skipped []string
+	}{
+		{
+			"if true",
+			".code $0200\n.if 1\n:yes hlt\n.else\n:no crn\n.endif\n",
+			nil, []byte{0x41}, []string{"yes"}, []string{"no"},
+		},
+		{
+			"if false",
+			".code $0200\n.if 2-2\n:yes hlt\n.else\n:no crn\n.endif\n",
+			nil, []byte{0x43}, []string{"no"}, []string{"yes"},
+		},
+		{
+			"ifdef with define",
+			".code $0200\n.ifdef DEBUG\n:trace hlt\n.endif\ncrn\n",
+			map[string]uint16{"DEBUG": 1}, []byte{0x41, 0x43}, []string{"trace"}, nil,
+		},
+		{
+			"ifdef without define",
+			".code $0200\n.ifdef DEBUG\n:trace hlt\n.endif\ncrn\n",
+			nil, []byte{0x43}, nil, []string{"trace"},
+		},
+		{
+			"ifndef",
+			".code $0200\n.ifndef DEBUG\n:release hlt\n.endif\n",
+			nil, []byte{0x41}, []string{"release"}, nil,
+		},
+		{
+			"define value",
+			".code $0200\n.if LEVEL-2\n:other hlt\n.else\n:two crn\n.endif\n",
+			map[string]uint16{"LEVEL": 2}, []byte{0x43}, []string{"two"}, []string{"other"},
+		},
+		{
+			"nested",
+			".code $0200\n.if 0\n.if 1\n:inner hlt\n.endif\n.else\n:outer crn\n.endif\n",
+			nil, []byte{0x43}, []string{"outer"}, []string{"inner"},
+		},
+		{
+			"same tag in both branches",
+			".code $0200\n.if 1\n:tag hlt\n.else\n:tag crn\n.endif\njmp tag\n",
+			nil, []byte{0x41, 0x20, 0x02, 0x00}, []string{"tag"}, nil,
+		},
+	}
+	for _, test := range tests {
+		program, diags := Assemble("test.asm", strings.NewReader(test.source), Options{Defines: test.defines})
+		if len(diags) > 0 {
+			t.Errorf("%s: unexpected diagnostics %v", test.name, diags)
+			continue
+		}
+		if code := program.Segments[0].Code; !bytes.Equal(code, test.code) {
+			t.Errorf("%s: got % x, want % x", test.name, code, test.code)
+		}
+		for _, name := range test.defined {
+			if _, ok := program.Symbols[name]; !ok {
+				t.Errorf("%s: expected %s to be defined", test.name, name)
+			}
+		}
+		for _, name := range test.skipped {
+			if _, ok := program.Symbols[name]; ok {
+				t.Errorf("%s: expected %s not to be defined", test.name, name)
+			}
+		}
+	}
+}
+
+func TestConditionalErrors(t *testing.T) {
+	tests := []struct {
+		source  string
+		message string
+	}{
+		{".if 1\n", "Expected .endif to close .if"},
+		{".endif\n", "Found .endif without .if"},
+		{".else\n", "Found .else without .if"},
+		{".if 1\n.else\n.else\n.endif\n", "Found a second .else for .if at test.asm:1"},
+		{".ifdef\n.endif\n", "Expected name after .ifdef"},
+		{".code $0200\n.if LATER\n.endif\n:LATER hlt\n", "LATER must be defined before being used here"},
+	}
+	for _, test := range tests {
+		_, diags := assembleSource(t, test.source)
+		if len(diags) == 0 || diags[0].Message != test.message {
+			t.Errorf("%q: got %v, want error %q", test.source, diags, test.message)
+		}
+	}
+}
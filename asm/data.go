@@ -0,0 +1,221 @@
+package tisasm
+
+import "io/ioutil"
+
+// maxBlockSize is the longest block that fits in the size of a ROM entry.
+const maxBlockSize = 0xffff
+
+// dataWriter places what data directives produce: in the code segment
+// when they are written in a .code section, or as data entries in .data.
+type dataWriter interface {
+	writeValue(token Token, width int)
+	writeBytes(bytes []byte)
+	writeFill(count int, value byte)
+	skip(count int)
+}
+
+func isDataDirective(token Token) bool {
+	if !token.IsType(TokenDirective) {
+		return false
+	}
+	switch token.Literal {
+	case ".byte", ".word", ".fill", ".space", ".ascii", ".asciz", ".incbin":
+		return true
+	default:
+		return false
+	}
+}
+
+// parseDataDirective parses .byte, .word, .fill, .space, .ascii, .asciz
+// and .incbin.
+func (prs *Parser) parseDataDirective(directive Token) {
+	writer := prs.dataWriter(directive)
+	switch directive.Literal {
+	case ".byte":
+		prs.parseList(directive, func(token Token) {
+			if token.IsType(TokenString) {
+				writer.writeBytes([]byte(token.Literal))
+				return
+			}
+			writer.writeValue(token, 1)
+		})
+	case ".word":
+		prs.parseList(directive, func(token Token) {
+			writer.writeValue(token, 2)
+		})
+	case ".ascii":
+		writer.writeBytes([]byte(prs.expectString(directive).Literal))
+	case ".asciz":
+		writer.writeBytes(append([]byte(prs.expectString(directive).Literal), 0x00))
+	case ".fill":
+		count := prs.immediateValue(prs.expectOperand(directive), 2)
+		value := 0
+		if next := prs.scan(); next.IsType(TokenComma) && isSameLine(next, directive) {
+			value = prs.immediateValue(prs.scan(), 1)
+		} else {
+			prs.unread(next)
+		}
+		writer.writeFill(count, byte(value))
+	case ".space":
+		writer.skip(prs.immediateValue(prs.expectOperand(directive), 2))
+	case ".incbin":
+		writer.writeBytes(prs.readBinary(prs.expectString(directive)))
+	}
+}
+
+// parseList calls parse with the first token of each of the comma
+// separated operands of the directive.
+func (prs *Parser) parseList(directive Token, parse func(Token)) {
+	parse(prs.expectOperand(directive))
+	next := prs.scan()
+	for next.IsType(TokenComma) && isSameLine(next, directive) {
+		parse(prs.scan())
+		next = prs.scan()
+	}
+	prs.unread(next)
+}
+
+func (prs *Parser) expectOperand(directive Token) Token {
+	token := prs.scan()
+	if !isSameLine(token, directive) {
+		prs.failf(token, "Expected value after %s", directive.Literal)
+	}
+	return token
+}
+
+func (prs *Parser) expectString(directive Token) Token {
+	token := prs.scan()
+	if !token.IsType(TokenString) || !isSameLine(token, directive) {
+		prs.failf(token, "Expected string after %s", directive.Literal)
+	}
+	return token
+}
+
+// readBinary reads a file for .incbin, searched like the files of .include.
+func (prs *Parser) readBinary(name Token) []byte {
+	path, ok := prs.findInclude(name, name.Literal)
+	if !ok {
+		prs.failf(name, "Cannot find binary file %s", name.Literal)
+	}
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		prs.failf(name, "Cannot read binary file %s", path)
+	}
+	if len(bytes) > maxBlockSize {
+		prs.failf(name, "Binary file %s is bigger than %d bytes", path, maxBlockSize)
+	}
+	return bytes
+}
+
+func (prs *Parser) dataWriter(directive Token) dataWriter {
+	switch prs.section {
+	case ".code":
+		return segmentWriter{prs, directive}
+	case ".data":
+		if prs.dataAddress < 0 {
+			prs.failf(directive, "Expected address before %s, there is no previous data entry", directive.Literal)
+		}
+		return entryWriter{prs, directive}
+	default:
+		prs.failf(directive, "Expected start of section before %s", directive.Literal)
+		return nil
+	}
+}
+
+// segmentWriter emits data in the current code segment. Values can use
+// tags defined later, like any other operand.
+type segmentWriter struct {
+	prs       *Parser
+	directive Token
+}
+
+func (writer segmentWriter) writeValue(token Token, width int) {
+	writer.prs.emitExpression(token, width)
+	writer.prs.checkMemoryLimit(writer.directive)
+}
+
+func (writer segmentWriter) writeBytes(bytes []byte) {
+	writer.prs.emitBytes(bytes...)
+	writer.prs.checkMemoryLimit(writer.directive)
+}
+
+func (writer segmentWriter) writeFill(count int, value byte) {
+	bytes := make([]byte, count)
+	for i := range bytes {
+		bytes[i] = value
+	}
+	writer.writeBytes(bytes)
+}
+
+func (writer segmentWriter) skip(count int) {
+	writer.writeBytes(make([]byte, count))
+}
+
+// entryWriter adds data entries after the previous one. Consecutive bytes
+// are joined in a single block entry.
+type entryWriter struct {
+	prs       *Parser
+	directive Token
+}
+
+// writeValue writes a value that can use tags defined later. They are
+// patched in the entry holding it at the end, like operands of the code.
+func (writer entryWriter) writeValue(token Token, width int) {
+	prs := writer.prs
+	expr, value, known := prs.operandValue(token, width)
+	writer.writeBytes(valueBytes(value, width))
+	if !known {
+		entry := len(prs.program.Data) - 1
+		offset := len(prs.program.Data[entry].Value) - width
+		prs.fixups = append(prs.fixups, fixup{true, entry, offset, width, expr})
+	}
+}
+
+func (writer entryWriter) writeBytes(bytes []byte) {
+	prs := writer.prs
+	if len(bytes) == 0 {
+		return
+	}
+	address := writer.reserve(len(bytes))
+	last := len(prs.program.Data) - 1
+	if last >= 0 && isBlockEndingAt(prs.program.Data[last], address) && prs.program.Data[last].size()+len(bytes) <= maxBlockSize {
+		prs.program.Data[last].Value = append(prs.program.Data[last].Value, bytes...)
+		return
+	}
+	prs.program.Data = append(prs.program.Data, DataEntry{
+		Address: uint16(address),
+		Type:    BlockType,
+		Value:   bytes,
+	})
+}
+
+func isBlockEndingAt(entry DataEntry, address int) bool {
+	return entry.Type == BlockType && int(entry.Address)+entry.size() == address
+}
+
+func (writer entryWriter) writeFill(count int, value byte) {
+	address := writer.reserve(count)
+	writer.prs.program.Data = append(writer.prs.program.Data, DataEntry{
+		Address: uint16(address),
+		Type:    FillType,
+		Value:   []byte{value},
+		Count:   uint16(count),
+	})
+}
+
+// skip reserves memory without writing it, so it takes no space in the ROM.
+func (writer entryWriter) skip(count int) {
+	writer.reserve(count)
+}
+
+// reserve returns the address of the next size bytes of data.
+func (writer entryWriter) reserve(size int) int {
+	prs := writer.prs
+	address := prs.dataAddress
+	if address+size > MemoryLimit {
+		prs.fail(writer.directive, "Memory limit exceed.")
+	}
+	prs.regions = append(prs.regions, region{address, size, writer.directive})
+	prs.dataAddress += size
+	return address
+}
@@ -0,0 +1,43 @@
+package tisasm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDataAfterString(t *testing.T) {
+	source := ".data\n:welcome $5000 \"hi\\n\"\n.byte 1, 2, 3\n.code $0200\nhlt\n"
+	program, diags := assembleSource(t, source)
+	if len(diags) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diags)
+	}
+	if len(program.Data) != 2 || program.Data[1].Address != 0x5004 {
+		t.Fatalf("got entries %+v, want the block at $5004 after the string and its 0x00", program.Data)
+	}
+	var listing bytes.Buffer
+	if err := program.WriteListing(&listing); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []string{"5000 68 69 0a 00", "5004 01 02 03"} {
+		if !strings.Contains(listing.String(), row) {
+			t.Errorf("expected row %q in the listing:\n%s", row, listing.String())
+		}
+	}
+}
+
+func TestDataForwardReferences(t *testing.T) {
+	source := ".data\n$5000 .word start, end+1\n.byte end-$01f0, 7\n.code $0200\n:start hlt\n:end crn\n"
+	program, diags := assembleSource(t, source)
+	if len(diags) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diags)
+	}
+	want := []byte{0x02, 0x00, 0x02, 0x02, 0x11, 0x07}
+	if len(program.Data) != 1 || !bytes.Equal(program.Data[0].Value, want) {
+		t.Errorf("got entries %+v, want a block with % x", program.Data, want)
+	}
+	_, diags = assembleSource(t, ".data\n$5000 .byte later\n.code $0200\n:later hlt\n")
+	if len(diags) != 1 || diags[0].Message != "Value 512 does not fit in 8 bits (0-255)" {
+		t.Errorf("got %v, want the value of later not to fit in a byte", diags)
+	}
+}
@@ -0,0 +1,237 @@
+package tisasm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+const (
+	// debugMagic starts the debug info, both in .dbg files and in the
+	// debug section of a ROM.
+	debugMagic = "TDBG"
+	// DebugVersion is the version of the debug info format. It changes
+	// whenever the format does.
+	DebugVersion byte = 1
+)
+
+// symbolKinds are the kinds of symbols in the order they are encoded.
+var symbolKinds = []SymbolKind{SymbolLabel, SymbolData, SymbolConstant, SymbolRegister}
+
+// DebugInfo links the addresses of a program to the source lines that
+// placed them, and has its symbols, so the address of an instruction can
+// be told in terms of the source without assembling it again.
+type DebugInfo struct {
+	Files   []string
+	Lines   []LineEntry
+	Symbols []Symbol
+}
+
+// LineEntry is memory placed by a line of the source. File is an index
+// of DebugInfo.Files. Macro expansions take the line of their call.
+type LineEntry struct {
+	Address uint16
+	Size    uint16
+	File    int
+	Line    int
+}
+
+func (entry LineEntry) contains(address uint16) bool {
+	return address >= entry.Address && int(address) < int(entry.Address)+int(entry.Size)
+}
+
+// DebugInfo builds the debug info from the statements that the parser
+// recorded while reading the source.
+func (program *Program) DebugInfo() DebugInfo {
+	info := DebugInfo{}
+	files := make(map[string]int)
+	fileIndex := func(file string) int {
+		index, ok := files[file]
+		if !ok {
+			index = len(info.Files)
+			files[file] = index
+			info.Files = append(info.Files, file)
+		}
+		return index
+	}
+	for _, file := range program.Files {
+		fileIndex(file)
+	}
+	for _, statement := range program.Statements {
+		if statement.Size == 0 {
+			continue
+		}
+		token := sourceToken(statement.Token)
+		info.Lines = append(info.Lines, LineEntry{statement.Address, uint16(statement.Size), fileIndex(token.File), token.Line})
+	}
+	for _, symbol := range program.sortedSymbols() {
+		fileIndex(symbol.Token.File)
+		info.Symbols = append(info.Symbols, symbol)
+	}
+	return info
+}
+
+// Line finds the source line that placed the address.
+func (info DebugInfo) Line(address uint16) (file string, line int, ok bool) {
+	for _, entry := range info.Lines {
+		if entry.contains(address) {
+			return info.Files[entry.File], entry.Line, true
+		}
+	}
+	return "", 0, false
+}
+
+// WriteTo writes the debug info in its binary format. All numbers are big
+// endian, like in the ROM, and strings end with 0x00:
+//
+//	"TDBG" version(1)
+//	files(2)   name...
+//	lines(4)   address(2) size(2) file(2) line(4)...
+//	symbols(4) value(2) kind(1) file(2) line(4) name...
+//
+// Kinds are 0 label, 1 data, 2 constant and 3 register.
+func (info DebugInfo) WriteTo(out io.Writer) (int64, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString(debugMagic)
+	buffer.WriteByte(DebugVersion)
+	files := make(map[string]int)
+	writeUint(&buffer, uint16(len(info.Files)))
+	for i, file := range info.Files {
+		files[file] = i
+		writeString(&buffer, file)
+	}
+	writeUint(&buffer, uint32(len(info.Lines)))
+	for _, entry := range info.Lines {
+		writeUint(&buffer, entry.Address)
+		writeUint(&buffer, entry.Size)
+		writeUint(&buffer, uint16(entry.File))
+		writeUint(&buffer, uint32(entry.Line))
+	}
+	writeUint(&buffer, uint32(len(info.Symbols)))
+	for _, symbol := range info.Symbols {
+		writeUint(&buffer, symbol.Value)
+		buffer.WriteByte(symbolKindIndex(symbol.Kind))
+		writeUint(&buffer, uint16(files[symbol.Token.File]))
+		writeUint(&buffer, uint32(symbol.Token.Line))
+		writeString(&buffer, symbol.Name)
+	}
+	written, err := out.Write(buffer.Bytes())
+	return int64(written), err
+}
+
+func symbolKindIndex(kind SymbolKind) byte {
+	for i, known := range symbolKinds {
+		if known == kind {
+			return byte(i)
+		}
+	}
+	return 0
+}
+
+func writeUint(buffer *bytes.Buffer, value interface{}) {
+	binary.Write(buffer, binary.BigEndian, value)
+}
+
+func writeString(buffer *bytes.Buffer, text string) {
+	buffer.WriteString(text)
+	buffer.WriteByte(0x00)
+}
+
+// ReadDebugInfo reads debug info written by DebugInfo.WriteTo.
+func ReadDebugInfo(name string, in io.Reader) (DebugInfo, error) {
+	diags := []Diagnostic{}
+	info := readDebugInfo(debugReader{in, name}, &diags)
+	if len(diags) > 0 {
+		return DebugInfo{}, diags[0]
+	}
+	return info, nil
+}
+
+func readDebugInfo(reader debugReader, diags *[]Diagnostic) (info DebugInfo) {
+	defer catchDiagnostic(diags)
+	magic := reader.bytes(len(debugMagic))
+	if string(magic) != debugMagic {
+		reader.fail("Expected debug info to start with %s", debugMagic)
+	}
+	if version := reader.bytes(1)[0]; version != DebugVersion {
+		reader.fail("Unsupported debug info version %d, expected %d", version, DebugVersion)
+	}
+	// Counts are not trusted to allocate, a broken file would just end
+	// before having that many items.
+	for count := reader.uint16(); count > 0; count-- {
+		info.Files = append(info.Files, reader.string())
+	}
+	for count := reader.uint32(); count > 0; count-- {
+		info.Lines = append(info.Lines, LineEntry{reader.uint16(), reader.uint16(), reader.file(info), int(reader.uint32())})
+	}
+	for count := reader.uint32(); count > 0; count-- {
+		symbol := Symbol{Value: reader.uint16()}
+		kind := int(reader.bytes(1)[0])
+		if kind >= len(symbolKinds) {
+			reader.fail("Unknown symbol kind %d", kind)
+		}
+		symbol.Kind = symbolKinds[kind]
+		symbol.Token.File = info.Files[reader.file(info)]
+		symbol.Token.Line = int(reader.uint32())
+		symbol.Name = reader.string()
+		symbol.Token.Literal = symbol.Name
+		info.Symbols = append(info.Symbols, symbol)
+	}
+	return info
+}
+
+// debugReader reads the fields of the debug info, bailing out with a
+// diagnostic when they are truncated.
+type debugReader struct {
+	in   io.Reader
+	name string
+}
+
+func (reader debugReader) fail(format string, replaces ...interface{}) {
+	bail(newDiagnostic(reader.name, format, replaces...))
+}
+
+func (reader debugReader) bytes(count int) []byte {
+	data := make([]byte, count)
+	if _, err := io.ReadFull(reader.in, data); err != nil {
+		reader.fail("Unexpected end of debug info")
+	}
+	return data
+}
+
+func (reader debugReader) uint16() uint16 {
+	return binary.BigEndian.Uint16(reader.bytes(2))
+}
+
+func (reader debugReader) uint32() uint32 {
+	return binary.BigEndian.Uint32(reader.bytes(4))
+}
+
+func (reader debugReader) file(info DebugInfo) int {
+	index := int(reader.uint16())
+	if index >= len(info.Files) {
+		reader.fail("File %d of debug info does not exist", index)
+	}
+	return index
+}
+
+func (reader debugReader) string() string {
+	text := []byte{}
+	for {
+		c := reader.bytes(1)[0]
+		if c == 0x00 {
+			return string(text)
+		}
+		text = append(text, c)
+	}
+}
+
+// debugSection is the debug info as a ROM section, after the section
+// flag: its size in four bytes and the debug info.
+func (info DebugInfo) debugSection() []byte {
+	var payload bytes.Buffer
+	info.WriteTo(&payload)
+	section := make([]byte, 4, 4+payload.Len())
+	binary.BigEndian.PutUint32(section, uint32(payload.Len()))
+	return append(section, payload.Bytes()...)
+}
@@ -0,0 +1,100 @@
+package tisasm
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// debugSource has code, data, constants and a macro call, so its debug
+// info has every kind of line and symbol.
+const debugSource = ".equ N 3\n.macro put r\n movi N r\n.endm\n.data\n:msg $5000 \"hi\"\n.code $0200\n:main put R1\n:.end hlt\n"
+
+// sameSymbols compares symbols by what the debug info keeps of them.
+func sameSymbols(got, want []Symbol) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i].Name != want[i].Name || got[i].Kind != want[i].Kind || got[i].Value != want[i].Value ||
+			got[i].Token.File != want[i].Token.File || got[i].Token.Line != want[i].Token.Line {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDebugInfoRoundTrip(t *testing.T) {
+	program, diags := assembleSource(t, debugSource)
+	if len(diags) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diags)
+	}
+	info := program.DebugInfo()
+	var written bytes.Buffer
+	if _, err := info.WriteTo(&written); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadDebugInfo("test.dbg", bytes.NewReader(written.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read.Files, info.Files) || !reflect.DeepEqual(read.Lines, info.Lines) {
+		t.Errorf("got files %v and lines %v, want %v and %v", read.Files, read.Lines, info.Files, info.Lines)
+	}
+	if !sameSymbols(read.Symbols, info.Symbols) {
+		t.Errorf("got symbols %v, want %v", read.Symbols, info.Symbols)
+	}
+	if file, line, ok := read.Line(0x0202); !ok || file != "test.asm" || line != 8 {
+		t.Errorf("got $0202 at %s:%d %v, want test.asm:8 from the macro call", file, line, ok)
+	}
+	// Debug info cut anywhere is reported, not read as a shorter one
+	for size := 0; size < written.Len(); size++ {
+		if _, err := ReadDebugInfo("test.dbg", bytes.NewReader(written.Bytes()[:size])); err == nil {
+			t.Errorf("debug info cut at %d bytes was read without errors", size)
+		}
+	}
+}
+
+func TestReadDebugInfoErrors(t *testing.T) {
+	tests := []struct {
+		info    string
+		message string
+	}{
+		{"TDBX\x01", "Expected debug info to start with TDBG"},
+		{"TDBG\x09", "Unsupported debug info version 9, expected 1"},
+		{"TDBG\x01\x00\x00\x00\x00\x00\x01\x02\x00\x00\x00\x00\x00\x00\x00", "File 0 of debug info does not exist"},
+		{"TDBG\x01\x00\x01a\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x07", "Unknown symbol kind 7"},
+	}
+	for _, test := range tests {
+		_, err := ReadDebugInfo("test.dbg", bytes.NewReader([]byte(test.info)))
+		if diag, ok := err.(Diagnostic); !ok || diag.Message != test.message {
+			t.Errorf("%q: got %v, want error %q", test.info, err, test.message)
+		}
+	}
+}
+
+func TestDiasembleDebugROM(t *testing.T) {
+	program, diags := assembleSource(t, debugSource)
+	if len(diags) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diags)
+	}
+	dis, diags := NewDiassembler("test.rom", bytes.NewReader(program.rom(true))).Diasemble()
+	if HasErrors(diags) {
+		t.Fatalf("unexpected diagnostics %v", diags)
+	}
+	if dis.Debug == nil {
+		t.Fatal("the debug section was not read")
+	}
+	info := program.DebugInfo()
+	if !reflect.DeepEqual(dis.Debug.Lines, info.Lines) || !sameSymbols(dis.Debug.Symbols, info.Symbols) {
+		t.Errorf("got debug info %+v, want %+v", *dis.Debug, info)
+	}
+	// The ROM without debug info has the same data and code
+	plain, diags := NewDiassembler("test.rom", bytes.NewReader(program.rom(false))).Diasemble()
+	if HasErrors(diags) {
+		t.Fatalf("unexpected diagnostics %v", diags)
+	}
+	if !reflect.DeepEqual(dis.Data, plain.Data) || !reflect.DeepEqual(dis.Segments, plain.Segments) {
+		t.Errorf("got %+v %+v, want %+v %+v", dis.Data, dis.Segments, plain.Data, plain.Segments)
+	}
+}
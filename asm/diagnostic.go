@@ -0,0 +1,195 @@
+package tisasm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityNote
+)
+
+func (severity Severity) String() string {
+	switch severity {
+	case SeverityWarning:
+		return "warning"
+	case SeverityNote:
+		return "note"
+	default:
+		return "error"
+	}
+}
+
+// Diagnostic is a problem found while assembling or diassembling. It is up
+// to the caller to decide how to show it and whether it should stop the program.
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+	File     string
+	Line     int
+	Column   int
+	Token    Token
+	Notes    []Diagnostic
+}
+
+func newDiagnostic(file string, format string, replaces ...interface{}) Diagnostic {
+	return Diagnostic{
+		Severity: SeverityError,
+		Message:  fmt.Sprintf(format, replaces...),
+		File:     file,
+	}
+}
+
+func newTokenDiagnostic(token Token, format string, replaces ...interface{}) Diagnostic {
+	diag := newDiagnostic(token.File, format, replaces...)
+	diag.Line = token.Line
+	diag.Column = token.Column
+	diag.Token = token
+	for expansion := token.Expansion; expansion != nil; expansion = expansion.Call.Expansion {
+		diag.Notes = append(diag.Notes, newNote(expansion.Call, "In expansion of macro %s", expansion.Macro))
+	}
+	for include := token.IncludedFrom; include != nil; include = include.IncludedFrom {
+		diag.Notes = append(diag.Notes, newNote(*include, "In file included from here"))
+	}
+	return diag
+}
+
+// newNote points to where the token of a diagnostic came from.
+func newNote(token Token, format string, replaces ...interface{}) Diagnostic {
+	return Diagnostic{
+		Severity: SeverityNote,
+		Message:  fmt.Sprintf(format, replaces...),
+		File:     token.File,
+		Line:     token.Line,
+		Column:   token.Column,
+		Token:    token,
+	}
+}
+
+func (diag Diagnostic) IsError() bool {
+	return diag.Severity == SeverityError
+}
+
+func (diag Diagnostic) Error() string {
+	switch {
+	case diag.Line == 0:
+		return fmt.Sprintf("%s: %s: %s", diag.File, diag.Severity, diag.Message)
+	case diag.Column == 0:
+		return fmt.Sprintf("%s:%d: %s: %s", diag.File, diag.Line, diag.Severity, diag.Message)
+	default:
+		return fmt.Sprintf("%s:%d:%d: %s: %s", diag.File, diag.Line, diag.Column, diag.Severity, diag.Message)
+	}
+}
+
+// SourceFiles holds the text of the assembled files, so diagnostics can
+// quote the line where they were found.
+type SourceFiles map[string][]byte
+
+func (sources SourceFiles) Line(file string, line int) (string, bool) {
+	lines := bytes.Split(sources[file], []byte("\n"))
+	if line < 1 || line > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(string(lines[line-1]), "\r"), true
+}
+
+// WriteDiagnostic prints the diagnostic compiler-style, followed by the
+// source line with the offending token underlined.
+func WriteDiagnostic(out io.Writer, diag Diagnostic, sources SourceFiles) {
+	fmt.Fprintln(out, diag.Error())
+	text, ok := sources.Line(diag.File, diag.Line)
+	if ok && diag.Column != 0 {
+		fmt.Fprintln(out, text)
+		fmt.Fprintln(out, underline(text, diag.Column, diag.Token.Length))
+	}
+	for _, note := range diag.Notes {
+		WriteDiagnostic(out, note, sources)
+	}
+}
+
+func underline(text string, column int, length int) string {
+	start := column - 1
+	if start > len(text) {
+		start = len(text)
+	}
+	end := start + length
+	if end > len(text) {
+		end = len(text)
+	}
+	var builder strings.Builder
+	for _, c := range text[:start] {
+		if c == '\t' {
+			builder.WriteRune('\t')
+		} else {
+			builder.WriteRune(' ')
+		}
+	}
+	builder.WriteRune('^')
+	for i := 1; i < utf8.RuneCountInString(text[start:end]); i++ {
+		builder.WriteRune('~')
+	}
+	return builder.String()
+}
+
+func HasErrors(diags []Diagnostic) bool {
+	return CountErrors(diags) > 0
+}
+
+func CountErrors(diags []Diagnostic) int {
+	count := 0
+	for _, diag := range diags {
+		if diag.IsError() {
+			count++
+		}
+	}
+	return count
+}
+
+// sortDiagnostics orders the diagnostics as they appear in the source,
+// since some of them, like undefined tags, are only found at the end.
+// Files are kept in the order they were opened.
+func sortDiagnostics(diags []Diagnostic, files []string) {
+	fileIndex := func(file string) int {
+		for i, name := range files {
+			if name == file {
+				return i
+			}
+		}
+		return len(files)
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].File != diags[j].File {
+			return fileIndex(diags[i].File) < fileIndex(diags[j].File)
+		}
+		if diags[i].Line != diags[j].Line {
+			return diags[i].Line < diags[j].Line
+		}
+		return diags[i].Column < diags[j].Column
+	})
+}
+
+// bail stops the current pass with the diagnostic. It must be paired
+// with a deferred catchDiagnostic.
+func bail(diag Diagnostic) {
+	panic(diag)
+}
+
+func catchDiagnostic(diags *[]Diagnostic) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	diag, ok := recovered.(Diagnostic)
+	if !ok {
+		panic(recovered)
+	}
+	*diags = append(*diags, diag)
+}
@@ -1,168 +1,332 @@
 package tisasm
 
 import (
-	"encoding/binary"
-	"encoding/hex"
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
-	"os"
+	"strings"
 )
 
-const (
-	DataSectionByte byte = 0x00
-	CodeSectoinByte      = 0x01
-)
+// Operand is a decoded operand of an instruction.
+type Operand struct {
+	Kind  OperandKind
+	Value int
+}
 
-const (
-	NumberType  byte = 0x02
-	StringType       = 0x01
-	SectionType      = 0x00
-)
+func (operand Operand) String() string {
+	return operand.Kind.Format(operand.Value)
+}
+
+// DecodedInstruction is an instruction read from memory. Bytes of code
+// that are not an instruction have no Mnemonic, and OpCode is the first
+// of them.
+type DecodedInstruction struct {
+	Address  uint16
+	OpCode   byte
+	Mnemonic string
+	Operands []Operand
+	Bytes    []byte
+}
+
+// String writes the instruction as source code.
+func (ins DecodedInstruction) String() string {
+	if ins.Mnemonic == "" {
+		values := make([]string, len(ins.Bytes))
+		for i, value := range ins.Bytes {
+			values[i] = fmt.Sprintf("%d", value)
+		}
+		return ".byte " + strings.Join(values, ", ")
+	}
+	kinds := make([]OperandKind, len(ins.Operands))
+	values := make([]int, len(ins.Operands))
+	for i, operand := range ins.Operands {
+		kinds[i], values[i] = operand.Kind, operand.Value
+	}
+	return Instruction{ins.Mnemonic, ins.OpCode, kinds}.Format(values)
+}
+
+// Decode decodes the instruction at the start of mem, that is loaded at
+// addr. It also returns the number of bytes the instruction takes.
+func Decode(mem []byte, addr uint16) (DecodedInstruction, int, error) {
+	if len(mem) == 0 {
+		return DecodedInstruction{}, 0, fmt.Errorf("Expected instruction at $%04x, but there are no bytes", addr)
+	}
+	ins, err := GetInstructionUsingOpcode(mem[0])
+	if err != nil {
+		return DecodedInstruction{}, 0, fmt.Errorf("%s at $%04x", err, addr)
+	}
+	values, err := ins.Decode(mem[1:])
+	if err != nil {
+		return DecodedInstruction{}, 0, fmt.Errorf("%s at $%04x", err, addr)
+	}
+	for i, value := range values {
+		// Registers above RegisterMax cannot be written back as
+		// source, so those bytes are not an instruction.
+		if ins.Operands[i] == OperandRegister && value > RegisterMax {
+			return DecodedInstruction{}, 0, fmt.Errorf("Register R%d of %s does not exist at $%04x", value, ins.Literal, addr)
+		}
+	}
+	decoded := DecodedInstruction{
+		Address:  addr,
+		OpCode:   ins.OpCode,
+		Mnemonic: ins.Literal,
+		Operands: make([]Operand, len(values)),
+		Bytes:    append([]byte{}, mem[:ins.Size()]...),
+	}
+	for i, value := range values {
+		decoded.Operands[i] = Operand{ins.Operands[i], value}
+	}
+	return decoded, ins.Size(), nil
+}
+
+// DecodedSegment is a code section of a ROM, with its bytes and the
+// instructions decoded from them.
+type DecodedSegment struct {
+	Origin       uint16
+	Code         []byte
+	Instructions []DecodedInstruction
+}
+
+// Disassembly is what a ROM has, in the order of the file. Debug is
+// the debug info of the ROM, if it has one.
+type Disassembly struct {
+	Data     []DataEntry
+	Segments []DecodedSegment
+	Debug    *DebugInfo
+}
+
+// Instructions returns the instructions of all the segments.
+func (dis *Disassembly) Instructions() []DecodedInstruction {
+	instructions := []DecodedInstruction{}
+	for _, segment := range dis.Segments {
+		instructions = append(instructions, segment.Instructions...)
+	}
+	return instructions
+}
 
+// Diassembler reads a ROM into a Disassembly.
 type Diassembler struct {
-	binaryFile  *os.File
-	currentLine int
-	eof         bool
+	name    string
+	in      *bufio.Reader
+	eof     bool
+	follow  bool
+	limited bool
+	start   uint16
+	end     uint16
+	dis     *Disassembly
+	diags   []Diagnostic
 }
 
-func NewDiassembler(file *os.File) Diassembler {
-	return Diassembler{file, 0, false}
+// NewDiassembler reads the ROM from in. The name is only used in the
+// diagnostics.
+func NewDiassembler(name string, in io.Reader) *Diassembler {
+	return &Diassembler{name: name, in: bufio.NewReader(in)}
 }
 
-func (dasm Diassembler) Diasemble() {
+// FollowControlFlow makes the diassembler decode only the code that can
+// be reached from the entry points, instead of every byte of the code
+// sections. See Disassembly.followControlFlow.
+func (dasm *Diassembler) FollowControlFlow() {
+	dasm.follow = true
+}
+
+// Diasemble reads the whole ROM. What was read before an error is
+// returned too.
+func (dasm *Diassembler) Diasemble() (*Disassembly, []Diagnostic) {
+	dasm.dis = &Disassembly{}
+	dasm.readSections()
+	return dasm.finish()
+}
+
+func (dasm *Diassembler) readSections() {
+	defer catchDiagnostic(&dasm.diags)
 	dasm.readSectionFlag()
-	switch dasm.readByte() {
-	case DataSectionByte:
-		dasm.readDataSection()
-	case CodeSectoinByte:
-		dasm.readCodeSection()
-	default:
-		ShowError("Expected valid section after section flag")
+	for {
+		switch dasm.readByte() {
+		case DataSectionByte:
+			dasm.readDataSection()
+		case CodeSectoinByte:
+			dasm.readCodeSection()
+			return
+		case SizedCodeSectionByte:
+			dasm.readSizedCodeSection()
+		case DebugSectionByte:
+			dasm.readDebugSection()
+		default:
+			dasm.readExtraSection()
+		}
+		if !dasm.readNextSectionFlag() {
+			return
+		}
+	}
+}
+
+// readNextSectionFlag reads the flag of the next section, if the file
+// does not end before.
+func (dasm *Diassembler) readNextSectionFlag() bool {
+	first := dasm.readByte()
+	if dasm.eof {
+		return false
+	}
+	if first != sectionStart[0] {
+		dasm.failf("Expected %x, but byte is %x", sectionStart, first)
 	}
+	dasm.expectBytes(sectionStart[1:]...)
+	return true
 }
 
-func (dasm Diassembler) readDataSection() {
-	fmt.Println(".data")
+func (dasm *Diassembler) readDataSection() {
 	for !dasm.eof {
-		dasm.readMemoryIgnoring()
-		fmt.Print(" ")
-		dataType := dasm.readByte()
-		if dataType == SectionType {
+		entry := DataEntry{Address: dasm.readWord()}
+		entry.Type = dasm.readByte()
+		switch entry.Type {
+		case SectionType:
+			return
+		case NumberType:
+			entry.Value = []byte{dasm.readByte()}
+		case StringType:
+			entry.Value = dasm.readString()
+		case BlockType:
+			entry.Value = dasm.readBytes(int(dasm.readWord()))
+		case FillType:
+			entry.Count = dasm.readWord()
+			entry.Value = []byte{dasm.readByte()}
+		default:
+			dasm.failf("Unkown data type: %x", entry.Type)
+		}
+		if dasm.eof {
 			break
-		} else if dataType == NumberType {
-			dasm.readNumber()
-		} else if dataType == StringType {
-			dasm.readString()
-		} else {
-			ShowErrorf("Unkown data type: %x", dataType)
 		}
-		fmt.Println()
+		dasm.dis.Data = append(dasm.dis.Data, entry)
 	}
-	if dasm.eof {
-		ShowError("Unexpected end of file in data section")
-	}
-	fmt.Println()
-	dasm.readSectionFlag()
-	dasm.expectBytes(0x01)
-	dasm.readCodeSection()
+	dasm.fail("Unexpected end of file in data section")
 }
 
-func (dasm Diassembler) readCodeSection() {
-	fmt.Print(".code ")
-	dasm.startLineAnnotation()
-	fmt.Println()
-	for !dasm.eof {
+// readCodeSection reads the code until the end of the file.
+func (dasm *Diassembler) readCodeSection() {
+	origin := dasm.readWord()
+	code := []byte{}
+	for {
 		b := dasm.readByte()
 		if dasm.eof {
 			break
 		}
-		ins, err := GetInstructionUsingOpcode(b)
-		if err != nil {
-			ShowErrorf("%e", err)
-		}
-		fmt.Printf("%s ", ins.Literal)
-		ins.Diassemble(dasm)
-		fmt.Printf("   \t\t;")
-		dasm.emitLineAnnotation()
-		dasm.currentLine += ins.MemorySize
+		code = append(code, b)
 	}
+	dasm.decodeSegment(origin, code)
 }
 
-func (dasm *Diassembler) startLineAnnotation() {
-	high := dasm.readByte()
-	low := dasm.readByte()
-	str := fmt.Sprintf("%02x%02x", high, low)
-	bytes, err := hex.DecodeString(str)
-	if err != nil {
-		ShowError("Malformed start code memory direction")
+func (dasm *Diassembler) readSizedCodeSection() {
+	origin := dasm.readWord()
+	code := dasm.readBytes(int(dasm.readWord()))
+	if dasm.eof {
+		dasm.fail("Unexpected end of file in code section")
 	}
-	dasm.currentLine = int(binary.BigEndian.Uint16(bytes))
-	fmt.Printf("$%s", str)
+	dasm.decodeSegment(origin, code)
 }
 
-func (dasm Diassembler) emitLineAnnotation() {
-	fmt.Print("$")
-	fmt.Printf("%04x\n", dasm.currentLine)
+// decodeSegment decodes the code of a segment. Bytes that are not an
+// instruction are kept as they are, with a warning for each run of them.
+func (dasm *Diassembler) decodeSegment(origin uint16, code []byte) {
+	segment := DecodedSegment{Origin: origin, Code: code}
+	if dasm.follow {
+		dasm.dis.Segments = append(dasm.dis.Segments, segment)
+		return
+	}
+	for offset := 0; offset < len(code); {
+		address := origin + uint16(offset)
+		ins, size, err := Decode(code[offset:], address)
+		if err != nil {
+			last := len(segment.Instructions) - 1
+			if last < 0 || segment.Instructions[last].Mnemonic != "" {
+				diag := newDiagnostic(dasm.name, "%s, it is written as .byte", err)
+				diag.Severity = SeverityWarning
+				dasm.diags = append(dasm.diags, diag)
+			}
+			ins = DecodedInstruction{Address: address, OpCode: code[offset], Bytes: code[offset : offset+1]}
+			size = 1
+		}
+		segment.Instructions = append(segment.Instructions, ins)
+		offset += size
+	}
+	dasm.dis.Segments = append(dasm.dis.Segments, segment)
 }
 
-func (dasm Diassembler) readSectionFlag() {
-	dasm.expectBytes(0xff, 0xfe, 0xfe, 0xff)
+func (dasm *Diassembler) readDebugSection() {
+	info, err := ReadDebugInfo(dasm.name, bytes.NewReader(dasm.readExtraSection()))
+	if err != nil {
+		bail(err.(Diagnostic))
+	}
+	dasm.dis.Debug = &info
 }
 
-func (dasm Diassembler) readMemoryIgnoring() {
-	high := dasm.readByte()
-	low := dasm.readByte()
-	if high == 0x00 && low == 0x00 {
-		return
+// readExtraSection reads a section that is not loaded. Those that are not
+// known are skipped, as the loader does.
+func (dasm *Diassembler) readExtraSection() []byte {
+	size := int(dasm.readWord())<<16 | int(dasm.readWord())
+	data := dasm.readBytes(size)
+	if dasm.eof {
+		dasm.fail("Unexpected end of file in section")
 	}
-	fmt.Printf("$%02x%02x", high, low)
+	return data
 }
 
-func (dasm Diassembler) readMemory() {
-	high := dasm.readByte()
-	low := dasm.readByte()
-	fmt.Printf("$%02x%02x", high, low)
+func (dasm *Diassembler) readSectionFlag() {
+	dasm.expectBytes(sectionStart...)
 }
 
-func (dasm Diassembler) readNumber() {
-	fmt.Printf("%d", dasm.readByte())
+func (dasm *Diassembler) readWord() uint16 {
+	high := dasm.readByte()
+	low := dasm.readByte()
+	return uint16(high)<<8 | uint16(low)
 }
 
-func (dasm Diassembler) readRegister() {
-	fmt.Print("R")
-	dasm.readNumber()
+// readBytes reads count bytes, or less if the file ends before.
+func (dasm *Diassembler) readBytes(count int) []byte {
+	data := []byte{}
+	for i := 0; i < count && !dasm.eof; i++ {
+		data = append(data, dasm.readByte())
+	}
+	return data
 }
 
-func (dasm Diassembler) readString() {
-	fmt.Print("\"")
+func (dasm *Diassembler) readString() []byte {
+	text := []byte{}
 	for {
 		current := dasm.readByte()
 		if current == 0x00 {
-			break
+			return text
 		}
-		fmt.Printf("%c", current)
+		text = append(text, current)
 	}
-	fmt.Print("\"")
 }
 
-func (dasm Diassembler) expectBytes(bytes ...byte) {
+func (dasm *Diassembler) expectBytes(bytes ...byte) {
 	for i := 0; i < len(bytes); i++ {
 		b := dasm.readByte()
 		if b != bytes[i] {
-			ShowErrorf("Expected %x, but %d byte is %x (not %x)\n", bytes, i+1, b, bytes[i])
+			dasm.failf("Expected %x, but %d byte is %x (not %x)", bytes, i+1, b, bytes[i])
 		}
 	}
 }
 
+func (dasm *Diassembler) fail(msg string) {
+	bail(newDiagnostic(dasm.name, "%s", msg))
+}
+
+func (dasm *Diassembler) failf(format string, replaces ...interface{}) {
+	dasm.fail(fmt.Sprintf(format, replaces...))
+}
+
 func (dasm *Diassembler) readByte() byte {
-	buffer := make([]byte, 1)
-	length, err := dasm.binaryFile.Read(buffer)
+	b, err := dasm.in.ReadByte()
 	if err == io.EOF {
 		dasm.eof = true
 		return 0x00
 	}
-	if length != 1 || err != nil {
-		ShowErrorf("Error while reading file %e\n", err)
+	if err != nil {
+		dasm.failf("Error while reading file: %s", err)
 	}
-	return buffer[0]
+	return b
 }
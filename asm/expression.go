@@ -0,0 +1,277 @@
+package tisasm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// expression is an operand computed from numbers, memory addresses and
+// symbols. It can only be evaluated once every symbol it uses is defined.
+type expression interface {
+	evaluate(symbols map[string]Symbol) (int, error)
+	span() Token
+}
+
+// undefinedSymbol is returned while evaluating an expression that uses a
+// symbol not defined yet.
+type undefinedSymbol struct {
+	token Token
+}
+
+func (err undefinedSymbol) Error() string {
+	if strings.HasPrefix(err.token.Literal, anonymousPrefix) {
+		return "Expected an anonymous tag to be defined after this"
+	}
+	return fmt.Sprintf("Expected tag %s to be defined", writtenName(err.token))
+}
+
+type numberExpression struct {
+	token Token
+	value int
+}
+
+func (expr numberExpression) evaluate(symbols map[string]Symbol) (int, error) {
+	return expr.value, nil
+}
+
+func (expr numberExpression) span() Token {
+	return expr.token
+}
+
+type symbolExpression struct {
+	token Token
+}
+
+func (expr symbolExpression) evaluate(symbols map[string]Symbol) (int, error) {
+	symbol, ok := symbols[expr.token.Literal]
+	if !ok {
+		return 0, undefinedSymbol{expr.token}
+	}
+	if symbol.Kind == SymbolRegister {
+		return 0, newTokenDiagnostic(expr.token, "Expected %s to be a value, but it is a register", expr.token.Literal)
+	}
+	return int(symbol.Value), nil
+}
+
+func (expr symbolExpression) span() Token {
+	return expr.token
+}
+
+type unaryExpression struct {
+	operator Token
+	operand  expression
+}
+
+func (expr unaryExpression) evaluate(symbols map[string]Symbol) (int, error) {
+	value, err := expr.operand.evaluate(symbols)
+	return -value, err
+}
+
+func (expr unaryExpression) span() Token {
+	return spanTokens(expr.operator, expr.operand.span())
+}
+
+type binaryExpression struct {
+	operator Token
+	left     expression
+	right    expression
+}
+
+func (expr binaryExpression) evaluate(symbols map[string]Symbol) (int, error) {
+	left, err := expr.left.evaluate(symbols)
+	if err != nil {
+		return 0, err
+	}
+	right, err := expr.right.evaluate(symbols)
+	if err != nil {
+		return 0, err
+	}
+	switch expr.operator.Literal {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/":
+		if right == 0 {
+			return 0, newTokenDiagnostic(expr.operator, "Division by zero")
+		}
+		return left / right, nil
+	case "&":
+		return left & right, nil
+	case "|":
+		return left | right, nil
+	case "<<":
+		return left << uint(right), nil
+	case ">>":
+		return left >> uint(right), nil
+	case "==":
+		return boolValue(left == right), nil
+	case "!=":
+		return boolValue(left != right), nil
+	case "<":
+		return boolValue(left < right), nil
+	case "<=":
+		return boolValue(left <= right), nil
+	case ">":
+		return boolValue(left > right), nil
+	case ">=":
+		return boolValue(left >= right), nil
+	default:
+		return 0, newTokenDiagnostic(expr.operator, "Unknown operator %s", expr.operator.Literal)
+	}
+}
+
+func boolValue(condition bool) int {
+	if condition {
+		return 1
+	}
+	return 0
+}
+
+func (expr binaryExpression) span() Token {
+	return spanTokens(expr.left.span(), expr.right.span())
+}
+
+// byteExpression is hi(expr) or lo(expr): the high or low byte of an address.
+type byteExpression struct {
+	function Token
+	argument expression
+	closing  Token
+}
+
+func (expr byteExpression) evaluate(symbols map[string]Symbol) (int, error) {
+	value, err := expr.argument.evaluate(symbols)
+	if strings.ToLower(expr.function.Literal) == "hi" {
+		return (value >> 8) & 0xff, err
+	}
+	return value & 0xff, err
+}
+
+func (expr byteExpression) span() Token {
+	return spanTokens(expr.function, expr.closing)
+}
+
+// spanTokens returns a token that covers from first to last, so errors
+// underline the whole expression.
+func spanTokens(first Token, last Token) Token {
+	if !isSameLine(first, last) {
+		return first
+	}
+	span := first
+	span.Length = last.Offset + last.Length - first.Offset
+	return span
+}
+
+// Binary operators from lowest to highest precedence.
+var binaryLevels = [][]string{
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"|"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/"},
+}
+
+func (prs *Parser) parseExpression(first Token) expression {
+	return prs.parseBinary(0, first)
+}
+
+func (prs *Parser) parseBinary(level int, first Token) expression {
+	if level == len(binaryLevels) {
+		return prs.parseUnary(first)
+	}
+	left := prs.parseBinary(level+1, first)
+	for {
+		operator := prs.scan()
+		if !isOperatorOf(operator, binaryLevels[level]) || !isSameLine(operator, left.span()) {
+			prs.unread(operator)
+			return left
+		}
+		right := prs.parseBinary(level+1, prs.scan())
+		left = binaryExpression{operator, left, right}
+	}
+}
+
+func isOperatorOf(token Token, operators []string) bool {
+	if !token.IsType(TokenOperator) {
+		return false
+	}
+	for _, operator := range operators {
+		if token.Literal == operator {
+			return true
+		}
+	}
+	return false
+}
+
+func (prs *Parser) parseUnary(token Token) expression {
+	if isOperatorOf(token, []string{"-"}) {
+		return unaryExpression{token, prs.parseUnary(prs.scan())}
+	}
+	return prs.parsePrimary(token)
+}
+
+func (prs *Parser) parsePrimary(token Token) expression {
+	switch token.TokenType {
+	case TokenNumber, TokenHex, TokenBinary:
+		return numberExpression{token, int(prs.integerValue(token))}
+	case TokenChar:
+		return numberExpression{token, int(token.Literal[0])}
+	case TokenMemory:
+		return numberExpression{token, int(prs.memoryValue(token))}
+	case TokenLeftParen:
+		inner := prs.parseExpression(prs.scan())
+		prs.expectClosing(token)
+		return inner
+	case TokenInstruction:
+		if prs.isInstructionName(token) {
+			prs.failf(token, "%s is an instruction, it cannot be used as a tag", token.Literal)
+		}
+		if isByteFunction(token) {
+			next := prs.scan()
+			if next.IsType(TokenLeftParen) && isSameLine(token, next) {
+				argument := prs.parseExpression(prs.scan())
+				return byteExpression{token, argument, prs.expectClosing(next)}
+			}
+			prs.unread(next)
+		}
+		return symbolExpression{token}
+	case TokenDirective:
+		return symbolExpression{prs.localTag(token)}
+	case TokenTag:
+		if token.Literal == "" {
+			prs.fail(token, "Expected :+ or :- to use an anonymous tag, ':' alone defines one")
+		}
+		if !isAnonymousReference(token.Literal) {
+			prs.failf(token, "Tags are used without ':', write %s", writtenName(token))
+		}
+		return symbolExpression{prs.anonymousTag(token)}
+	default:
+		prs.fail(token, "Expected a number, a memory address or a tag")
+		return nil
+	}
+}
+
+func isByteFunction(token Token) bool {
+	name := strings.ToLower(token.Literal)
+	return name == "hi" || name == "lo"
+}
+
+func (prs *Parser) expectClosing(opening Token) Token {
+	closing := prs.scan()
+	if !closing.IsType(TokenRightParen) {
+		prs.fail(closing, "Expected ')' to close '('")
+	}
+	return closing
+}
+
+// fitValue checks that the value can be emitted in width bytes.
+func fitValue(expr expression, value int, width int) error {
+	max := 1<<(8*uint(width)) - 1
+	if value < 0 || value > max {
+		return newTokenDiagnostic(expr.span(), "Value %d does not fit in %d bits (0-%d)", value, 8*width, max)
+	}
+	return nil
+}
@@ -4,18 +4,18 @@ import (
 	"os"
 )
 
-func OpenFile(path string) *os.File {
+func OpenFile(path string) (*os.File, error) {
 	data, err := os.Open(path)
 	if err != nil {
-		ShowError("File not found")
+		return nil, newDiagnostic(path, "File not found")
 	}
-	return data
+	return data, nil
 }
 
-func CreateFile(path string) *os.File {
+func CreateFile(path string) (*os.File, error) {
 	file, err := os.Create(path)
 	if err != nil {
-		ShowErrorf("%s", err)
+		return nil, newDiagnostic(path, "%s", err)
 	}
-	return file
+	return file, nil
 }
@@ -3,18 +3,32 @@ package tisasm
 import (
 	"bufio"
 	"io"
+	"strconv"
 	"unicode"
 )
 
 type FileScanner struct {
-	reader     *bufio.Reader
-	word       []rune
-	lastReaded rune
-	line       int
+	name         string
+	reader       *bufio.Reader
+	word         []rune
+	lastReaded   rune
+	line         int
+	column       int
+	offset       int
+	start        Token
+	includedFrom *Token
 }
 
-func NewFileScanner(reader *bufio.Reader) *FileScanner {
-	return &FileScanner{reader, []rune{}, ' ', 1}
+func NewFileScanner(name string, reader *bufio.Reader) *FileScanner {
+	return &FileScanner{
+		name:       name,
+		reader:     reader,
+		word:       []rune{},
+		lastReaded: ' ',
+		line:       1,
+		column:     1,
+		offset:     0,
+	}
 }
 
 func (scn *FileScanner) skipWhitespaces() {
@@ -23,26 +37,22 @@ func (scn *FileScanner) skipWhitespaces() {
 			return
 		}
 		switch scn.current() {
-		case '\t', '\r', ' ':
-			scn.consume()
-		case '\n':
-			scn.line++
+		case '\t', '\r', ' ', '\n':
 			scn.consume()
 		case ';':
 			scn.consumeUntil('\n')
-			scn.line++
 		default:
 			return
 		}
 	}
 }
 
-func (scn FileScanner) isCurrentWhitespace() bool {
+func (scn *FileScanner) isCurrentWhitespace() bool {
 	c := scn.current()
 	return c == '\n' || c == ' ' || c == '\t' || c == '\r'
 }
 
-func (scn FileScanner) consumeUntil(end rune) {
+func (scn *FileScanner) consumeUntil(end rune) {
 	c := scn.current()
 	for !scn.isAtEnd() && c != end {
 		c = scn.consume()
@@ -55,22 +65,37 @@ func (scn *FileScanner) consume() rune {
 	return readed
 }
 
-func (scn FileScanner) skip() rune {
-	readed, _, err := scn.reader.ReadRune()
+func (scn *FileScanner) skip() rune {
+	readed, size, err := scn.reader.ReadRune()
 	if err != nil {
 		panic(err)
 	}
 	scn.lastReaded = readed
+	scn.offset += size
+	scn.column += size
+	if readed == '\n' {
+		scn.line++
+		scn.column = 1
+	}
 	return readed
 }
 
-func (scn FileScanner) skipExpected(expected rune, msg string) {
-	if expected != scn.skip() {
-		ShowErrorf("%s at line %d", msg, scn.line)
+// markStart remembers where the token being scanned begins.
+func (scn *FileScanner) markStart() {
+	scn.start = Token{
+		File:         scn.name,
+		Line:         scn.line,
+		Column:       scn.column,
+		Offset:       scn.offset,
+		IncludedFrom: scn.includedFrom,
 	}
 }
 
-func (scn FileScanner) current() rune {
+func (scn *FileScanner) skipExpected(expected rune) bool {
+	return !scn.isAtEnd() && expected == scn.skip()
+}
+
+func (scn *FileScanner) current() rune {
 	runes, err := scn.reader.Peek(1)
 	if err != nil {
 		return scn.lastReaded
@@ -78,11 +103,14 @@ func (scn FileScanner) current() rune {
 	return rune(runes[0])
 }
 
-func (scn FileScanner) isNumeric() bool {
+func (scn *FileScanner) isNumeric() bool {
 	return !scn.isAtEnd() && unicode.IsDigit(scn.current())
 }
 
-func (scn FileScanner) isHex() bool {
+func (scn *FileScanner) isHex() bool {
+	if scn.isAtEnd() {
+		return false
+	}
 	c := scn.current()
 	return scn.isNumeric() ||
 		c == 'A' || c == 'a' ||
@@ -93,7 +121,7 @@ func (scn FileScanner) isHex() bool {
 		c == 'F' || c == 'f'
 }
 
-func (scn FileScanner) isLetter() bool {
+func (scn *FileScanner) isLetter() bool {
 	if scn.isAtEnd() {
 		return false
 	}
@@ -101,137 +129,234 @@ func (scn FileScanner) isLetter() bool {
 	return (unicode.IsLetter(c) || c == '_') && c != '"'
 }
 
-func (scn FileScanner) isInstruction() bool {
+func (scn *FileScanner) isInstruction() bool {
 	return scn.isLetter() && !scn.isRegister()
 }
 
-func (scn FileScanner) isRegister() bool {
-	c := scn.current()
-	return c == 'R'
+func (scn *FileScanner) isRegister() bool {
+	runes, err := scn.reader.Peek(2)
+	return err == nil && runes[0] == 'R' && unicode.IsDigit(rune(runes[1]))
 }
 
-func (scn FileScanner) scanNumber() Token {
-	if scn.current() != '0' {
-		return scn.scanDecimal()
-	}
-	scn.skip()
-	scn.skipExpected('x', "Numbers which starts with '0' must be hexadecimal. 'x' charater expected after 0.")
-	return scn.scanHexadecimal()
+func (scn *FileScanner) isBinary() bool {
+	return !scn.isAtEnd() && (scn.current() == '0' || scn.current() == '1')
 }
 
-func (scn FileScanner) scanHexadecimal() Token {
-	for scn.isHex() {
-		scn.consume()
+// scanNumber reads decimal numbers, hexadecimal numbers after 0x and
+// binary numbers after 0b. The prefix is not part of the literal.
+func (scn *FileScanner) scanNumber() Token {
+	prefix, err := scn.reader.Peek(2)
+	if err != nil || prefix[0] != '0' {
+		return scn.scanDigits(TokenNumber, scn.isNumeric, "decimal")
+	}
+	switch prefix[1] {
+	case 'x', 'X':
+		scn.skip()
+		scn.skip()
+		return scn.scanDigits(TokenHex, scn.isHex, "hexadecimal")
+	case 'b', 'B':
+		scn.skip()
+		scn.skip()
+		return scn.scanDigits(TokenBinary, scn.isBinary, "binary")
+	default:
+		return scn.scanDigits(TokenNumber, scn.isNumeric, "decimal")
 	}
-	return scn.createToken(TokenHex)
 }
 
-func (scn FileScanner) scanDecimal() Token {
-	for scn.isNumeric() {
+func (scn *FileScanner) scanDigits(tokenType TokenType, isDigit func() bool, base string) Token {
+	for isDigit() {
 		scn.consume()
 	}
-	if scn.current() == '.' {
-		scn.consume()
-		for scn.isNumeric() {
+	if len(scn.word) == 0 {
+		return scn.createError("Expected " + base + " digits after the prefix")
+	}
+	if scn.isLetter() || scn.isNumeric() || (!scn.isAtEnd() && scn.current() == '.') {
+		for scn.isLetter() || scn.isNumeric() || (!scn.isAtEnd() && scn.current() == '.') {
 			scn.consume()
 		}
+		return scn.createError("Invalid " + base + " number " + string(scn.word))
 	}
-	return scn.createToken(TokenNumber)
+	return scn.createToken(tokenType)
 }
 
-func (scn FileScanner) scanSection() Token {
+func (scn *FileScanner) scanSection() Token {
 	scn.consume() // Consume dot
-	for scn.isLetter() {
+	for scn.isLetter() || scn.isNumeric() {
 		scn.consume()
 	}
-	return scn.createToken(TokenSection)
+	switch string(scn.word) {
+	case ".data", ".code":
+		return scn.createToken(TokenSection)
+	default:
+		return scn.createToken(TokenDirective)
+	}
 }
 
-func (scn FileScanner) scanInstruction() Token {
-	for scn.isLetter() {
+func (scn *FileScanner) scanInstruction() Token {
+	// Dots are allowed inside names to write local tags as global.local
+	for scn.isLetter() || scn.isNumeric() || (!scn.isAtEnd() && scn.current() == '.') {
 		scn.consume()
 	}
 	return scn.createToken(TokenInstruction)
 }
 
-func (scn FileScanner) isAtEnd() bool {
+func (scn *FileScanner) isAtEnd() bool {
 	_, err := scn.reader.Peek(1)
 	return err == io.EOF
 }
 
-func (scn FileScanner) scanString() Token {
-	scn.skipExpected('"', "Expected '\"' at start of string")
-	for !scn.isAtEnd() && scn.current() != '"' {
-		if scn.current() == '\n' || scn.isAtEnd() {
-			return scn.createError("Unterminated string")
+// scanString reads a string between double quotes. The literal of the
+// token has its escape sequences already replaced.
+func (scn *FileScanner) scanString() Token {
+	scn.skip() // Consume opening quote
+	value := []byte{}
+	for !scn.isAtEnd() && scn.current() != '"' && scn.current() != '\n' {
+		bytes, err := scn.scanStringChar()
+		if err != "" {
+			return scn.createError(err)
 		}
-		scn.consume()
+		value = append(value, bytes...)
 	}
-	if !scn.isAtEnd() {
-		scn.skipExpected('"', "Expected '\"' at end of string")
+	if !scn.skipExpected('"') {
+		return scn.createError("Unterminated string")
 	}
-	return scn.createToken(TokenString)
+	token := scn.createToken(TokenString)
+	token.Literal = string(value)
+	return token
 }
 
-func (scn FileScanner) scanDirection() Token {
-	scn.skipExpected('$', "Expected '$' at start of memory direction")
-	for i := 0; i < 4; i++ {
-		if scn.isAtEnd() || scn.current() == '\n' {
-			return scn.createError("Unterminated memory direction")
+// scanStringChar reads a character of a string or a character literal,
+// which can be an escape sequence. If it fails, it returns the error.
+func (scn *FileScanner) scanStringChar() ([]byte, string) {
+	c := scn.consume()
+	if c != '\\' {
+		return []byte(string(c)), ""
+	}
+	if scn.isAtEnd() || scn.current() == '\n' {
+		return nil, "Expected escape sequence after '\\'"
+	}
+	switch escaped := scn.consume(); escaped {
+	case 'n':
+		return []byte{'\n'}, ""
+	case 't':
+		return []byte{'\t'}, ""
+	case 'r':
+		return []byte{'\r'}, ""
+	case '0':
+		return []byte{0x00}, ""
+	case '\\', '"', '\'':
+		return []byte{byte(escaped)}, ""
+	case 'x':
+		digits := []rune{}
+		for len(digits) < 2 && scn.isHex() {
+			digits = append(digits, scn.consume())
+		}
+		value, err := strconv.ParseUint(string(digits), 16, 8)
+		if err != nil || len(digits) != 2 {
+			return nil, "Expected two hexadecimal digits after '\\x'"
 		}
+		return []byte{byte(value)}, ""
+	default:
+		return nil, "Unknown escape sequence '\\" + string(escaped) + "'"
+	}
+}
+
+func (scn *FileScanner) scanDirection() Token {
+	scn.skip() // Consume dollar
+	for !scn.isAtEnd() && scn.isHex() {
 		scn.consume()
 	}
+	if len(scn.word) != 4 {
+		return scn.createError("Malformed memory direction, expected four hexadecimal digits after '$'")
+	}
 	return scn.createToken(TokenMemory)
 }
 
-func (scn FileScanner) scanCharacter() Token {
-	scn.skipExpected('\'', "Expected ''' at start of character")
-	scn.consume()
-	scn.skipExpected('\'', "Expected ''' at end of character")
-	return scn.createToken(TokenChar)
+func (scn *FileScanner) scanCharacter() Token {
+	scn.skip() // Consume opening quote
+	if scn.isAtEnd() || scn.current() == '\n' || scn.current() == '\'' {
+		return scn.createError("Expected a character between quotes")
+	}
+	value, err := scn.scanStringChar()
+	if err != "" {
+		return scn.createError(err)
+	}
+	if len(value) != 1 {
+		return scn.createError("Character " + string(value) + " does not fit in a byte")
+	}
+	if !scn.skipExpected('\'') {
+		return scn.createError("Expected ''' at end of character")
+	}
+	token := scn.createToken(TokenChar)
+	token.Literal = string(value)
+	return token
 }
 
-func (scn FileScanner) scanRegister() Token {
-	startRegister := scn.skip()
-	if startRegister != 'R' && startRegister != 'r' {
-		ShowError("Expected register to start with 'R' or 'r'")
+func (scn *FileScanner) scanRegister() Token {
+	scn.skip() // Consume R
+	if scn.isAtEnd() || scn.isCurrentWhitespace() {
+		return scn.createError("Expected register number after 'R'")
 	}
-	scn.consume()
-	if !scn.isCurrentWhitespace() {
+	// The whole word is read, so registerValue tells R123 or R1x do
+	// not exist instead of splitting them.
+	for scn.isLetter() || scn.isNumeric() {
 		scn.consume()
 	}
 	return scn.createToken(TokenRegister)
 }
 
-func (scn FileScanner) scanTag() Token {
-	scn.skipExpected(':', "Expected ':' before tag")
-	for !scn.isCurrentWhitespace() {
-		scn.consume()
+func (scn *FileScanner) scanOperator() Token {
+	operator := scn.consume()
+	switch operator {
+	case '<', '>':
+		if !scn.consumeExpected(operator) {
+			scn.consumeExpected('=')
+		}
+	case '=', '!':
+		if !scn.consumeExpected('=') {
+			return scn.createError("Unknown operator, did you mean '" + string(operator) + "='?")
+		}
 	}
-	return scn.createToken(TokenTag)
+	return scn.createToken(TokenOperator)
 }
 
-func (scn FileScanner) createToken(tokenType TokenType) Token {
-	return Token{
-		TokenType: tokenType,
-		Literal:   string(scn.word),
-		Line:      scn.line,
+func (scn *FileScanner) consumeExpected(expected rune) bool {
+	if scn.isAtEnd() || scn.current() != expected {
+		return false
 	}
+	scn.consume()
+	return true
 }
 
-func (scn FileScanner) createError(msg string) Token {
-	return Token{
-		TokenType: TokenError,
-		Literal:   msg,
+func (scn *FileScanner) scanTag() Token {
+	scn.skip() // Consume colon
+	for !scn.isAtEnd() && !scn.isCurrentWhitespace() {
+		scn.consume()
 	}
+	return scn.createToken(TokenTag)
+}
+
+func (scn *FileScanner) createToken(tokenType TokenType) Token {
+	token := scn.start
+	token.TokenType = tokenType
+	token.Literal = string(scn.word)
+	token.Length = scn.offset - token.Offset
+	return token
+}
+
+func (scn *FileScanner) createError(msg string) Token {
+	token := scn.createToken(TokenError)
+	token.Literal = msg
+	return token
 }
 
 func (scn *FileScanner) Scan() Token {
 	scn.skipWhitespaces()
+	scn.word = []rune{}
+	scn.markStart()
 	if scn.isAtEnd() {
 		return scn.createToken(TokenEof)
 	}
-	scn.word = []rune{}
 	if scn.isNumeric() {
 		return scn.scanNumber()
 	}
@@ -252,16 +377,19 @@ func (scn *FileScanner) Scan() Token {
 		return scn.scanCharacter()
 	case ':':
 		return scn.scanTag()
+	case ',':
+		scn.consume()
+		return scn.createToken(TokenComma)
+	case '(':
+		scn.consume()
+		return scn.createToken(TokenLeftParen)
+	case ')':
+		scn.consume()
+		return scn.createToken(TokenRightParen)
+	case '+', '-', '*', '/', '&', '|', '<', '>', '=', '!':
+		return scn.scanOperator()
 	default:
+		scn.skip()
 		return scn.createError("Unknown token")
 	}
 }
-
-func (scn FileScanner) Advance(times int) {
-	for i := 0; i < times; i++ {
-		token := scn.Scan()
-		if !token.IsCorrect() {
-			break
-		}
-	}
-}
@@ -0,0 +1,68 @@
+package tisasm
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func scanFirst(source string) Token {
+	return NewFileScanner("test.asm", bufio.NewReader(strings.NewReader(source))).Scan()
+}
+
+func TestScanLiterals(t *testing.T) {
+	tests := []struct {
+		source    string
+		tokenType TokenType
+		literal   string
+	}{
+		{"0", TokenNumber, "0"},
+		{"42", TokenNumber, "42"},
+		{"0x1f", TokenHex, "1f"},
+		{"0XFF", TokenHex, "FF"},
+		{"0b101", TokenBinary, "101"},
+		{"0B0", TokenBinary, "0"},
+		{"'A'", TokenChar, "A"},
+		{`'\n'`, TokenChar, "\n"},
+		{`'\''`, TokenChar, "'"},
+		{`"plain"`, TokenString, "plain"},
+		{`"a\nb"`, TokenString, "a\nb"},
+		{`"\tx\r"`, TokenString, "\tx\r"},
+		{`"say \"hi\""`, TokenString, `say "hi"`},
+		{`"end\0"`, TokenString, "end\x00"},
+		{`"\x41\x7e"`, TokenString, "A~"},
+		{`"back\\slash"`, TokenString, `back\slash`},
+	}
+	for _, test := range tests {
+		token := scanFirst(test.source)
+		if token.TokenType != test.tokenType || token.Literal != test.literal {
+			t.Errorf("%s: got %s %q, want %s %q", test.source, token.TokenType, token.Literal, test.tokenType, test.literal)
+		}
+	}
+}
+
+func TestScanLiteralErrors(t *testing.T) {
+	tests := []struct {
+		source  string
+		message string
+	}{
+		{"1.5", "Invalid decimal number 1.5"},
+		{"12ab", "Invalid decimal number 12ab"},
+		{"0x", "Expected hexadecimal digits after the prefix"},
+		{"0b", "Expected binary digits after the prefix"},
+		{"0b102", "Invalid binary number 102"},
+		{"0x1g", "Invalid hexadecimal number 1g"},
+		{`"\q"`, `Unknown escape sequence '\q'`},
+		{`"\x4"`, `Expected two hexadecimal digits after '\x'`},
+		{`"open`, "Unterminated string"},
+		{"''", "Expected a character between quotes"},
+		{"'ab'", "Expected ''' at end of character"},
+		{"'é'", "Character é does not fit in a byte"},
+	}
+	for _, test := range tests {
+		token := scanFirst(test.source)
+		if token.TokenType != TokenError || token.Literal != test.message {
+			t.Errorf("%s: got %s %q, want error %q", test.source, token.TokenType, token.Literal, test.message)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package tisasm
+
+import "fmt"
+
+const (
+	// vectorsEnd is where the interrupt vectors end. A movm that writes
+	// below it installs a handler, so its value is code.
+	vectorsEnd = 0x0100
+	// dataRunSize is how many bytes that cannot be reached are written
+	// in each .byte line.
+	dataRunSize = 8
+)
+
+// codeFlow tells where the execution can go after an instruction: to the
+// addresses of targets, and to the next instruction when it falls through.
+func codeFlow(ins DecodedInstruction) (targets []uint16, fallsThrough bool) {
+	switch ins.Mnemonic {
+	case "jmp":
+		return []uint16{uint16(ins.Operands[0].Value)}, false
+	case "jeq", "jne", "jgt", "jlt", "cll":
+		return []uint16{uint16(ins.Operands[0].Value)}, true
+	case "jfg":
+		return []uint16{uint16(ins.Operands[1].Value)}, true
+	case "movm":
+		if ins.Operands[1].Value < vectorsEnd {
+			return []uint16{uint16(ins.Operands[0].Value)}, true
+		}
+		return nil, true
+	case "hlt", "crn":
+		return nil, false
+	}
+	return nil, true
+}
+
+// codeTraversal decodes the code that the execution can reach, starting
+// from the entry points.
+type codeTraversal struct {
+	name     string
+	segments []DecodedSegment
+	decoded  map[uint16]DecodedInstruction
+	// starts has the address of the instruction that covers each decoded
+	// byte.
+	starts  map[uint16]uint16
+	pending []uint16
+	diags   []Diagnostic
+}
+
+// followControlFlow decodes the segments again, from the origin of the
+// first one and following the jumps, the calls and the interrupt vectors
+// installed by movm. Bytes that are not reached are kept as data, so
+// tables and padding between the code do not break the instructions
+// after them. Addresses outside the segments are not followed.
+func (dis *Disassembly) followControlFlow(name string) []Diagnostic {
+	if len(dis.Segments) == 0 {
+		return nil
+	}
+	traversal := codeTraversal{
+		name:     name,
+		segments: dis.Segments,
+		decoded:  make(map[uint16]DecodedInstruction),
+		starts:   make(map[uint16]uint16),
+		pending:  []uint16{dis.Segments[0].Origin},
+	}
+	for len(traversal.pending) > 0 {
+		last := len(traversal.pending) - 1
+		address := traversal.pending[last]
+		traversal.pending = traversal.pending[:last]
+		traversal.follow(address)
+	}
+	for i := range dis.Segments {
+		dis.Segments[i].Instructions = traversal.instructions(dis.Segments[i])
+	}
+	return traversal.diags
+}
+
+// follow decodes the instructions from the address until the execution
+// cannot fall through, or reaches code already decoded.
+func (traversal *codeTraversal) follow(address uint16) {
+	for {
+		if _, ok := traversal.decoded[address]; ok {
+			return
+		}
+		if start, ok := traversal.starts[address]; ok {
+			traversal.warn("Code at $%04x is in the middle of the instruction at $%04x, it is not followed", address, start)
+			return
+		}
+		code, ok := traversal.codeAt(address)
+		if !ok {
+			return
+		}
+		ins, size, err := Decode(code, address)
+		if err != nil {
+			traversal.warn("%s, it is written as .byte", err)
+			return
+		}
+		for i := 1; i < size; i++ {
+			if start, ok := traversal.starts[address+uint16(i)]; ok {
+				traversal.warn("Instruction at $%04x overlaps the one at $%04x, it is not followed", address, start)
+				return
+			}
+		}
+		traversal.decoded[address] = ins
+		for i := 0; i < size; i++ {
+			traversal.starts[address+uint16(i)] = address
+		}
+		targets, fallsThrough := codeFlow(ins)
+		traversal.pending = append(traversal.pending, targets...)
+		if !fallsThrough || int(address)+size > 0xffff {
+			return
+		}
+		address += uint16(size)
+	}
+}
+
+// codeAt returns the code of the segment that has the address, from it
+// to the end of the segment.
+func (traversal *codeTraversal) codeAt(address uint16) ([]byte, bool) {
+	for _, segment := range traversal.segments {
+		offset := int(address) - int(segment.Origin)
+		if offset >= 0 && offset < len(segment.Code) {
+			return segment.Code[offset:], true
+		}
+	}
+	return nil, false
+}
+
+// instructions lists the decoded instructions of the segment, and the
+// bytes between them as data.
+func (traversal *codeTraversal) instructions(segment DecodedSegment) []DecodedInstruction {
+	instructions := []DecodedInstruction{}
+	for offset := 0; offset < len(segment.Code); {
+		address := segment.Origin + uint16(offset)
+		if ins, ok := traversal.decoded[address]; ok {
+			instructions = append(instructions, ins)
+			offset += len(ins.Bytes)
+			continue
+		}
+		end := offset + 1
+		for end < len(segment.Code) && end-offset < dataRunSize {
+			if _, ok := traversal.decoded[segment.Origin+uint16(end)]; ok {
+				break
+			}
+			end++
+		}
+		data := segment.Code[offset:end]
+		instructions = append(instructions, DecodedInstruction{Address: address, OpCode: data[0], Bytes: data})
+		offset = end
+	}
+	return instructions
+}
+
+func (traversal *codeTraversal) warn(format string, replaces ...interface{}) {
+	diag := newDiagnostic(traversal.name, "%s", fmt.Sprintf(format, replaces...))
+	diag.Severity = SeverityWarning
+	traversal.diags = append(traversal.diags, diag)
+}
@@ -0,0 +1,100 @@
+package tisasm
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestFollowControlFlow(t *testing.T) {
+	tests := []struct {
+		name         string
+		memory       []byte
+		start        uint16
+		instructions []string
+		warnings     []string
+	}{
+		{
+			"bytes not reached are data",
+			[]byte{0x20, 0x02, 0x05, 0xff, 0xff, 0x41},
+			0,
+			[]string{"$0200 jmp $0205", "$0203 .byte 255, 255", "$0205 hlt"},
+			nil,
+		},
+		{
+			"data runs of 8 bytes",
+			[]byte{0x20, 0x02, 0x0d, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 0x41},
+			0,
+			[]string{"$0200 jmp $020d", "$0203 .byte 1, 2, 3, 4, 5, 6, 7, 8", "$020b .byte 9, 10", "$020d hlt"},
+			nil,
+		},
+		{
+			"movm installing a vector",
+			[]byte{0x39, 0x02, 0x0a, 0x00, 0x10, 0x41, 0xff, 0xff, 0xff, 0xff, 0x43},
+			0,
+			[]string{"$0200 movm $020a $0010", "$0205 hlt", "$0206 .byte 255, 255, 255, 255", "$020a crn"},
+			nil,
+		},
+		{
+			"movm writing data",
+			[]byte{0x39, 0x02, 0x0a, 0x50, 0x00, 0x41, 0xff, 0xff, 0xff, 0xff, 0x43},
+			0,
+			[]string{"$0200 movm $020a $5000", "$0205 hlt", "$0206 .byte 255, 255, 255, 255, 67"},
+			nil,
+		},
+		{
+			"jump to the middle of an instruction",
+			[]byte{0x21, 0x02, 0x02, 0x41},
+			0,
+			[]string{"$0200 jeq $0202", "$0203 hlt"},
+			[]string{"Code at $0202 is in the middle of the instruction at $0200, it is not followed"},
+		},
+		{
+			"instruction overlapping another",
+			[]byte{0x21, 0x02, 0x08, 0x20, 0x02, 0x09, 0xff, 0xff, 0x02, 0x41},
+			0,
+			[]string{"$0200 jeq $0208", "$0203 jmp $0209", "$0206 .byte 255, 255, 2", "$0209 hlt"},
+			[]string{"Instruction at $0208 overlaps the one at $0209, it is not followed"},
+		},
+		{
+			"unknown opcode",
+			[]byte{0x20, 0x02, 0x03, 0xff},
+			0,
+			[]string{"$0200 jmp $0203", "$0203 .byte 255"},
+			[]string{"Undefined instruction opcode ff at $0203, it is written as .byte"},
+		},
+		{
+			"from -start",
+			[]byte{0x20, 0x02, 0x10, 0x20, 0x02, 0x08, 0xff, 0xff, 0x41},
+			0x0203,
+			[]string{"$0203 jmp $0208", "$0206 .byte 255, 255", "$0208 hlt"},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		dasm := NewDiassembler("test.bin", bytes.NewReader(test.memory))
+		dasm.FollowControlFlow()
+		if test.start != 0 {
+			dasm.DecodeRange(test.start, 0xffff)
+		}
+		dis, diags := dasm.DiasembleRaw(0x0200)
+		instructions := []string{}
+		for _, ins := range dis.Instructions() {
+			instructions = append(instructions, fmt.Sprintf("$%04x %s", ins.Address, ins))
+		}
+		if !reflect.DeepEqual(instructions, test.instructions) {
+			t.Errorf("%s: got %q, want %q", test.name, instructions, test.instructions)
+		}
+		var warnings []string
+		for _, diag := range diags {
+			if diag.Severity != SeverityWarning {
+				t.Errorf("%s: unexpected diagnostic %v", test.name, diag)
+			}
+			warnings = append(warnings, diag.Message)
+		}
+		if !reflect.DeepEqual(warnings, test.warnings) {
+			t.Errorf("%s: got warnings %q, want %q", test.name, warnings, test.warnings)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package tisasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// blockLineSize is how many bytes of a block are shown in each line.
+const blockLineSize = 16
+
+// TextFormatter writes a disassembly as text, with the address of each
+// instruction in a comment.
+type TextFormatter struct {
+	tags    map[uint16][]string
+	debug   *DebugInfo
+	sources SourceFiles
+}
+
+func NewTextFormatter() *TextFormatter {
+	return &TextFormatter{
+		tags:    make(map[uint16][]string),
+		sources: make(SourceFiles),
+	}
+}
+
+// UseSymbols makes the formatter write the tags of the symbols before
+// the code and data at their addresses.
+func (formatter *TextFormatter) UseSymbols(symbols []Symbol) {
+	for _, symbol := range symbols {
+		if symbol.IsAddress() && !containsString(formatter.tags[symbol.Value], symbol.Name) {
+			formatter.tags[symbol.Value] = append(formatter.tags[symbol.Value], symbol.Name)
+		}
+	}
+}
+
+func containsString(list []string, text string) bool {
+	for _, item := range list {
+		if item == text {
+			return true
+		}
+	}
+	return false
+}
+
+// UseDebugInfo makes the formatter write the source line of the
+// instructions before them, and the tags of the debug info. Without it,
+// the debug info of the disassembly is used if there is one.
+func (formatter *TextFormatter) UseDebugInfo(info DebugInfo) {
+	formatter.debug = &info
+	formatter.UseSymbols(info.Symbols)
+}
+
+func (formatter *TextFormatter) Write(out io.Writer, dis *Disassembly) error {
+	if formatter.debug == nil && dis.Debug != nil {
+		formatter.UseDebugInfo(*dis.Debug)
+	}
+	writer := bufio.NewWriter(out)
+	if len(dis.Data) > 0 {
+		fmt.Fprintln(writer, ".data")
+		for _, entry := range dis.Data {
+			formatter.writeDataEntry(writer, entry)
+		}
+		fmt.Fprintln(writer)
+	}
+	for i, segment := range dis.Segments {
+		if i > 0 {
+			fmt.Fprintln(writer)
+		}
+		formatter.writeSegment(writer, segment)
+	}
+	return writer.Flush()
+}
+
+func (formatter *TextFormatter) writeDataEntry(out io.Writer, entry DataEntry) {
+	for _, tag := range formatter.tags[entry.Address] {
+		fmt.Fprintf(out, ":%s ", tag)
+	}
+	fmt.Fprintf(out, "$%04x ", entry.Address)
+	switch entry.Type {
+	case NumberType:
+		fmt.Fprintf(out, "%d", entry.Value[0])
+	case StringType:
+		fmt.Fprintf(out, "\"%s\"", entry.Value)
+	case BlockType:
+		writeBlock(out, entry)
+	case FillType:
+		fmt.Fprintf(out, ".fill %d, %d", entry.Count, entry.Value[0])
+	}
+	fmt.Fprintln(out)
+}
+
+// writeBlock writes the bytes of a block entry as .byte lines of
+// blockLineSize bytes. The lines after the first start with their address.
+func writeBlock(out io.Writer, entry DataEntry) {
+	for i, value := range entry.Value {
+		switch {
+		case i == 0:
+			fmt.Fprint(out, ".byte ")
+		case i%blockLineSize == 0:
+			fmt.Fprintf(out, "\n$%04x .byte ", entry.Address+uint16(i))
+		default:
+			fmt.Fprint(out, ", ")
+		}
+		fmt.Fprintf(out, "%d", value)
+	}
+}
+
+func (formatter *TextFormatter) writeSegment(out io.Writer, segment DecodedSegment) {
+	fmt.Fprintf(out, ".code $%04x\n", segment.Origin)
+	lastSource := ""
+	for _, ins := range segment.Instructions {
+		for _, tag := range formatter.tags[ins.Address] {
+			fmt.Fprintf(out, ":%s\n", tag)
+		}
+		formatter.writeSourceLine(out, ins.Address, &lastSource)
+		fmt.Fprintf(out, "%s   \t\t;$%04x\n", ins, ins.Address)
+	}
+}
+
+// writeSourceLine writes the line of the source that placed the address,
+// if it is not the same line written before.
+func (formatter *TextFormatter) writeSourceLine(out io.Writer, address uint16, last *string) {
+	if formatter.debug == nil {
+		return
+	}
+	file, line, ok := formatter.debug.Line(address)
+	position := fmt.Sprintf("%s:%d", file, line)
+	if !ok || position == *last {
+		return
+	}
+	*last = position
+	text, _ := formatter.sourceLine(file, line)
+	fmt.Fprintf(out, "; %s: %s\n", position, strings.TrimSpace(text))
+}
+
+// sourceLine reads the line from the source file, if it can be found.
+func (formatter *TextFormatter) sourceLine(file string, line int) (string, bool) {
+	if _, ok := formatter.sources[file]; !ok {
+		source, _ := ioutil.ReadFile(file)
+		formatter.sources[file] = source
+	}
+	return formatter.sources.Line(file, line)
+}
@@ -0,0 +1,70 @@
+package tisasm
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// parseInclude reads the file named by the directive right where the
+// directive is, as if its contents were written there.
+func (prs *Parser) parseInclude(directive Token) {
+	name := prs.scan()
+	if !name.IsType(TokenString) || !isSameLine(name, directive) {
+		prs.fail(name, "Expected file name between quotes after .include")
+	}
+	path, ok := prs.findInclude(directive, name.Literal)
+	if !ok {
+		prs.failf(name, "Cannot find included file %s", name.Literal)
+	}
+	if isIncluding(directive, path) {
+		prs.failf(name, "File %s includes itself", path)
+	}
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		prs.failf(name, "Cannot read included file %s", path)
+	}
+	if _, ok := prs.program.Sources[path]; !ok {
+		// Files included more than once are listed once
+		prs.program.Files = append(prs.program.Files, path)
+	}
+	prs.program.Sources[path] = source
+	scanner := NewFileScanner(path, bufio.NewReader(bytes.NewReader(source)))
+	scanner.includedFrom = &directive
+	prs.pushScanner(scanner)
+}
+
+// findInclude looks for the file next to the file that includes it, and
+// then in the include directories in order.
+func (prs *Parser) findInclude(directive Token, name string) (string, bool) {
+	if filepath.IsAbs(name) {
+		return name, isFile(name)
+	}
+	dirs := append([]string{filepath.Dir(directive.File)}, prs.includeDirs...)
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		if isFile(path) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// isIncluding tells if path is one of the files that are being read
+// when the directive is found.
+func isIncluding(directive Token, path string) bool {
+	path = filepath.Clean(path)
+	for token := &directive; token != nil; token = token.IncludedFrom {
+		if filepath.Clean(token.File) == path {
+			return true
+		}
+	}
+	return false
+}
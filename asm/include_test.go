@@ -0,0 +1,113 @@
+package tisasm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes the files in a new temporary directory, named by
+// their path inside it. It returns the directory and how to remove it.
+func writeFiles(t *testing.T, files map[string]string) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "tisasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestIncludeSearchOrder(t *testing.T) {
+	dir, remove := writeFiles(t, map[string]string{
+		"src/near.inc":    ".equ V 1\n",
+		"first/near.inc":  ".equ V 2\n",
+		"first/far.inc":   ".equ V 3\n",
+		"second/far.inc":  ".equ V 4\n",
+		"second/only.inc": ".equ V 5\n",
+	})
+	defer remove()
+	first, second := filepath.Join(dir, "first"), filepath.Join(dir, "second")
+	tests := []struct {
+		name string
+		dirs []string
+		want uint16
+	}{
+		{"near.inc", []string{first}, 1},
+		{"far.inc", []string{first, second}, 3},
+		{"far.inc", []string{second, first}, 4},
+		{"only.inc", []string{first, second}, 5},
+	}
+	for _, test := range tests {
+		source := ".include \"" + test.name + "\"\n.code $0200\nhlt\n"
+		program, diags := Assemble(filepath.Join(dir, "src", "main.asm"), strings.NewReader(source), Options{IncludeDirs: test.dirs})
+		if len(diags) > 0 {
+			t.Errorf("%s %v: unexpected diagnostics %v", test.name, test.dirs, diags)
+			continue
+		}
+		if value := program.Symbols["V"].Value; value != test.want {
+			t.Errorf("%s %v: included the file with V %d, want %d", test.name, test.dirs, value, test.want)
+		}
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	dir, remove := writeFiles(t, map[string]string{
+		"a.inc":     ".include \"b.inc\"\n",
+		"b.inc":     ".include \"a.inc\"\n",
+		"self.inc":  ".include \"self.inc\"\n",
+		"twice.inc": ".equ T 1\n",
+	})
+	defer remove()
+	tests := []struct {
+		source  string
+		message string
+	}{
+		{".include \"a.inc\"\n", "File " + filepath.Join(dir, "a.inc") + " includes itself"},
+		{".include \"self.inc\"\n", "File " + filepath.Join(dir, "self.inc") + " includes itself"},
+		{".include \"missing.inc\"\n", "Cannot find included file missing.inc"},
+		{".include missing\n", "Expected file name between quotes after .include"},
+		{".include \"twice.inc\"\n.include \"twice.inc\"\n", "T is already defined at " + filepath.Join(dir, "twice.inc") + ":1"},
+	}
+	for _, test := range tests {
+		source := test.source + ".code $0200\nhlt\n"
+		_, diags := Assemble(filepath.Join(dir, "main.asm"), strings.NewReader(source), Options{})
+		if len(diags) == 0 || diags[0].Message != test.message {
+			t.Errorf("%q: got %v, want error %q", test.source, diags, test.message)
+		}
+	}
+}
+
+func TestIncludeTwiceListedOnce(t *testing.T) {
+	dir, remove := writeFiles(t, map[string]string{
+		"put.inc": "movi 1 R1\n",
+	})
+	defer remove()
+	main := filepath.Join(dir, "main.asm")
+	source := ".code $0200\n.include \"put.inc\"\n.include \"put.inc\"\nhlt\n"
+	program, diags := Assemble(main, strings.NewReader(source), Options{})
+	if len(diags) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diags)
+	}
+	if want := []string{main, filepath.Join(dir, "put.inc")}; len(program.Files) != 2 || program.Files[0] != want[0] || program.Files[1] != want[1] {
+		t.Errorf("got files %v, want %v", program.Files, want)
+	}
+	var listing bytes.Buffer
+	if err := program.WriteListing(&listing); err != nil {
+		t.Fatal(err)
+	}
+	if count := strings.Count(listing.String(), "; "+filepath.Join(dir, "put.inc")); count != 1 {
+		t.Errorf("put.inc is listed %d times:\n%s", count, listing.String())
+	}
+}
@@ -0,0 +1,205 @@
+// Code generated by isagen from isa.txt. DO NOT EDIT.
+
+package tisasm
+
+var instructions []Instruction = []Instruction{
+	// Aritmetico-Logicos 0x0 y 0x1
+	{
+		Literal:  "add", // Add register. acc + Rx -> acc
+		OpCode:   0x01,
+		Operands: []OperandKind{OperandRegister},
+	},
+	{
+		Literal:  "addi", // Add integer. acc + INT -> acc
+		OpCode:   0x02,
+		Operands: []OperandKind{OperandNumber},
+	},
+	{
+		Literal:  "sub", // Substract register. acc - Rx -> acc
+		OpCode:   0x03,
+		Operands: []OperandKind{OperandRegister},
+	},
+	{
+		Literal:  "subi", // Substract integer. acc - INT -> acc
+		OpCode:   0x04,
+		Operands: []OperandKind{OperandNumber},
+	},
+	{
+		Literal:  "sil", // Shift left. acc << 1 -> acc
+		OpCode:   0x05,
+		Operands: nil,
+	},
+	{
+		Literal:  "sir", // Shift right. acc >> 1 -> acc
+		OpCode:   0x06,
+		Operands: nil,
+	},
+	{
+		Literal:  "and", // And register. acc & Rx -> acc
+		OpCode:   0x07,
+		Operands: []OperandKind{OperandRegister},
+	},
+	{
+		Literal:  "or", // Or register. acc | Rx -> acc
+		OpCode:   0x08,
+		Operands: []OperandKind{OperandRegister},
+	},
+	{
+		Literal:  "xor", // eXclusive OR register. acc ^ Rx -> acc
+		OpCode:   0x09,
+		Operands: []OperandKind{OperandRegister},
+	},
+	{
+		Literal:  "not", // Not. ~acc -> acc
+		OpCode:   0x0a,
+		Operands: nil,
+	},
+
+	// Salto 0x2
+	{
+		Literal:  "jmp", // Inconditional jump
+		OpCode:   0x20,
+		Operands: []OperandKind{OperandAddress},
+	},
+	{
+		Literal:  "jeq", // Jump equals. If acc == 0, jump to mem
+		OpCode:   0x21,
+		Operands: []OperandKind{OperandAddress},
+	},
+	{
+		Literal:  "jne", // Jump not equal. If acc != 0, jump to mem
+		OpCode:   0x22,
+		Operands: []OperandKind{OperandAddress},
+	},
+	{
+		Literal:  "jgt", // Jump Greater Than. If acc > 0, jump to mem
+		OpCode:   0x23,
+		Operands: []OperandKind{OperandAddress},
+	},
+	{
+		Literal:  "jlt", // Jump Lower Than. If acc < 0, jump to mem
+		OpCode:   0x24,
+		Operands: []OperandKind{OperandAddress},
+	},
+	{
+		Literal:  "jfg", // Jump If flag is setted. If Flags[INT], jump to mem
+		OpCode:   0x25,
+		Operands: []OperandKind{OperandNumber, OperandAddress},
+	},
+
+	// Movimiento 0x3
+	{
+		Literal:  "ldr", // Load register. $mem -> Rx
+		OpCode:   0x30,
+		Operands: []OperandKind{OperandAddress, OperandRegister},
+	},
+	{
+		Literal:  "str", // Store register. Rx -> $mem
+		OpCode:   0x31,
+		Operands: []OperandKind{OperandRegister, OperandAddress},
+	},
+	{
+		Literal:  "mov", // Move. Rx -> Ry
+		OpCode:   0x32,
+		Operands: []OperandKind{OperandRegister, OperandRegister},
+	},
+	{
+		Literal:  "movi", // Move Integer. INT -> Rx
+		OpCode:   0x33,
+		Operands: []OperandKind{OperandNumber, OperandRegister},
+	},
+	{
+		Literal:  "tar", // Translate ACC to Rx. acc -> Rx
+		OpCode:   0x34,
+		Operands: []OperandKind{OperandRegister},
+	},
+	{
+		Literal:  "tra", // Translate Rx to ACC. Rx -> ACC
+		OpCode:   0x35,
+		Operands: []OperandKind{OperandRegister},
+	},
+	{
+		Literal:  "inr", // Read indirection. Reads the byte that points the memory stored in MEM
+		OpCode:   0x36,
+		Operands: []OperandKind{OperandAddress, OperandRegister},
+	},
+	{
+		Literal:  "inw", // Write indirection. Writes the byte that points the memory stored in MEM
+		OpCode:   0x37,
+		Operands: []OperandKind{OperandRegister, OperandAddress},
+	},
+	{
+		Literal:  "dsk", // Writes disk content into memory direction
+		OpCode:   0x38,
+		Operands: []OperandKind{OperandAddress},
+	},
+	{
+		Literal:  "movm", // Write two bytes into destiny direction and the next one
+		OpCode:   0x39,
+		Operands: []OperandKind{OperandAddress, OperandAddress},
+	},
+
+	// Llamadas 0x4
+	{
+		Literal:  "int", // Call interruption
+		OpCode:   0x40,
+		Operands: []OperandKind{OperandNumber},
+	},
+	{
+		Literal:  "hlt", // Halt execution
+		OpCode:   0x41,
+		Operands: nil,
+	},
+	{
+		Literal:  "cll", // Call subrutine that starts from $mem
+		OpCode:   0x42,
+		Operands: []OperandKind{OperandAddress},
+	},
+	{
+		Literal:  "crn", // Returns control to calling subrutine
+		OpCode:   0x43,
+		Operands: nil,
+	},
+	{
+		Literal:  "pmd", // Enable protected mode
+		OpCode:   0x44,
+		Operands: nil,
+	},
+	{
+		Literal:  "ein", // Enable interruptions
+		OpCode:   0x45,
+		Operands: nil,
+	},
+	{
+		Literal:  "din", // Disable interruptions
+		OpCode:   0x46,
+		Operands: nil,
+	},
+	{
+		Literal:  "cfg", // Clear flag with number
+		OpCode:   0x47,
+		Operands: []OperandKind{OperandNumber},
+	},
+
+	// Stack manipulation 0x5
+	{
+		Literal:  "psa", // Push acc
+		OpCode:   0x50,
+		Operands: nil,
+	},
+	{
+		Literal:  "poa", // Pop to acc
+		OpCode:   0x51,
+		Operands: nil,
+	},
+	{
+		Literal:  "psr", // Push register Rx
+		OpCode:   0x52,
+		Operands: []OperandKind{OperandRegister},
+	},
+	{
+		Literal:  "por", // Pop to register Rx
+		OpCode:   0x53,
+		Operands: []OperandKind{OperandRegister},
+	},
+}
@@ -0,0 +1,138 @@
+package tisasm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// anonymousPrefix names the symbols of anonymous tags. Users cannot
+// write it, since '@' is not allowed in names.
+const anonymousPrefix = "@anonymous"
+
+// isLocalTag tells if the tag is written as .name, scoped to the last
+// global tag.
+func isLocalTag(literal string) bool {
+	return strings.HasPrefix(literal, ".")
+}
+
+// isAnonymousReference tells if the literal is :+, :++, :- or :--,
+// without the colon.
+func isAnonymousReference(literal string) bool {
+	return literal != "" && (strings.Trim(literal, "+") == "" || strings.Trim(literal, "-") == "")
+}
+
+// defineLabel defines the tag of a code line. Anonymous tags are written
+// as a single ':', local tags take the name of the last global tag.
+func (prs *Parser) defineLabel(tag Token) {
+	switch {
+	case tag.Literal == "":
+		prs.anonymous++
+		tag.Literal = fmt.Sprintf("%s%d", anonymousPrefix, prs.anonymous)
+		prs.define(tag, SymbolLabel, prs.currentAddress())
+	case isLocalTag(tag.Literal):
+		prs.checkTagName(tag)
+		prs.define(prs.localTag(tag), SymbolLabel, prs.currentAddress())
+	default:
+		tag = prs.globalTag(tag)
+		prs.define(tag, SymbolLabel, prs.currentAddress())
+		if tag.Expansion == nil {
+			// Tags of macros are not seen by the user, so they
+			// do not change the scope of local tags.
+			prs.scope = tag.Literal
+		}
+	}
+}
+
+// globalTag checks that the tag can be defined as a global name.
+func (prs *Parser) globalTag(tag Token) Token {
+	if tag.Literal == "" || isAnonymousReference(tag.Literal) {
+		prs.fail(tag, "Anonymous tags can only be defined in the code section, as a single ':'")
+	}
+	if _, err := GetInstruction(strings.ToLower(tag.Literal)); err == nil {
+		prs.failf(tag, "Instruction %s cannot be used as a tag name", tag.Literal)
+	}
+	prs.checkTagName(tag)
+	if isLocalTag(tag.Literal) {
+		return prs.localTag(tag)
+	}
+	return tag
+}
+
+// checkTagName checks that the tag can be referenced once defined. Tags
+// renamed by a macro are checked as they are written in it.
+func (prs *Parser) checkTagName(tag Token) {
+	name := writtenName(tag)
+	if isLocalTag(name) {
+		name = name[1:]
+		if strings.Contains(name, ".") {
+			prs.failf(tag, "Local tag %s cannot have '.' in its name", tag.Literal)
+		}
+	}
+	if !isTagName(name) {
+		prs.failf(tag, "Tag %s must have letters, digits, '_' and '.', and start with a letter or '_'", tag.Literal)
+	}
+	if isRegisterName(name) {
+		prs.failf(tag, "Tag %s cannot be used, it is read as a register", tag.Literal)
+	}
+}
+
+// writtenName is the name of the tag as written in the source, without
+// the suffix that macros add to their tags.
+func writtenName(tag Token) string {
+	if at := strings.Index(tag.Literal, "@"); at >= 0 && tag.Expansion != nil {
+		return tag.Literal[:at]
+	}
+	return tag.Literal
+}
+
+// isTagName tells if the name is made of letters, digits, '_' and '.',
+// and starts with a letter or '_'.
+func isTagName(name string) bool {
+	for i, c := range name {
+		isLetter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+		isDigit := c >= '0' && c <= '9'
+		if !isLetter && (i == 0 || !isDigit && c != '.') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// isRegisterName tells if the scanner reads the name as a register, as it
+// does with any name that starts with R and a digit.
+func isRegisterName(name string) bool {
+	return len(name) > 1 && name[0] == 'R' && name[1] >= '0' && name[1] <= '9'
+}
+
+// localTag qualifies .name with the last global tag.
+func (prs *Parser) localTag(tag Token) Token {
+	if prs.scope == "" {
+		prs.failf(tag, "Local tag %s must be written after a global tag", tag.Literal)
+	}
+	tag.Literal = prs.scope + tag.Literal
+	return tag
+}
+
+// isInstructionName tells if the token is an instruction that is not
+// defined as a symbol.
+func (prs *Parser) isInstructionName(token Token) bool {
+	if _, ok := prs.program.Symbols[token.Literal]; ok {
+		return false
+	}
+	_, err := GetInstruction(strings.ToLower(token.Literal))
+	return err == nil
+}
+
+// anonymousTag finds the anonymous tag that the reference points to. It
+// may not be defined yet.
+func (prs *Parser) anonymousTag(reference Token) Token {
+	index := prs.anonymous - len(reference.Literal) + 1
+	if strings.HasPrefix(reference.Literal, "+") {
+		index = prs.anonymous + len(reference.Literal)
+	}
+	if index < 1 {
+		prs.failf(reference, "There is no anonymous tag before :%s", reference.Literal)
+	}
+	reference.Literal = fmt.Sprintf("%s%d", anonymousPrefix, index)
+	return reference
+}
@@ -0,0 +1,70 @@
+package tisasm
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLabelResolution(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		code   []byte
+	}{
+		{
+			"local tags of each global tag",
+			".code $0200\n:one jmp .loop\n:.loop hlt\n:two jmp .loop\n:.loop jmp one.loop\n",
+			[]byte{0x20, 0x02, 0x03, 0x41, 0x20, 0x02, 0x07, 0x20, 0x02, 0x03},
+		},
+		{
+			"anonymous tags",
+			".code $0200\n: jmp :+\n: jmp :-\n jmp :--\n: hlt\n",
+			[]byte{0x20, 0x02, 0x03, 0x20, 0x02, 0x03, 0x20, 0x02, 0x00, 0x41},
+		},
+		{
+			"anonymous tags ahead",
+			".code $0200\n jmp :++\n: crn\n: hlt\n",
+			[]byte{0x20, 0x02, 0x04, 0x43, 0x41},
+		},
+		{
+			"local tags after tags of macros",
+			".macro wait\n:loop jne loop\n.endm\n.code $0200\n:main wait\n jmp .end\n:.end hlt\n",
+			[]byte{0x22, 0x02, 0x00, 0x20, 0x02, 0x06, 0x41},
+		},
+	}
+	for _, test := range tests {
+		program, diags := assembleSource(t, test.source)
+		if len(diags) > 0 {
+			t.Errorf("%s: unexpected diagnostics %v", test.name, diags)
+			continue
+		}
+		if code := program.Segments[0].Code; !bytes.Equal(code, test.code) {
+			t.Errorf("%s: got % x, want % x", test.name, code, test.code)
+		}
+	}
+}
+
+func TestLabelErrors(t *testing.T) {
+	tests := []struct {
+		source  string
+		message string
+	}{
+		{".code $0200\n:a hlt\n:a hlt\n", "a is already defined at test.asm:2"},
+		{".code $0200\n:a hlt\n:.x hlt\n:.x hlt\n", "a.x is already defined at test.asm:3"},
+		{".code $0200\n:a hlt\n.data\n:a $5000 1\n", "a is already defined at test.asm:2"},
+		{".equ a 1\n.code $0200\n:a hlt\n", "a is already defined at test.asm:1"},
+		{".code $0200\n:.x hlt\n", "Local tag .x must be written after a global tag"},
+		{".code $0200\n:a hlt\n:.x.y hlt\n", "Local tag .x.y cannot have '.' in its name"},
+		{".code $0200\n:R1x hlt\n", "Tag R1x cannot be used, it is read as a register"},
+		{".code $0200\n:movi hlt\n", "Instruction movi cannot be used as a tag name"},
+		{".code $0200\n jmp :-\n", "There is no anonymous tag before :-"},
+		{".code $0200\n jmp :+\n", "Expected an anonymous tag to be defined after this"},
+		{".data\n: $5000 1\n.code $0200\nhlt\n", "Anonymous tags can only be defined in the code section, as a single ':'"},
+	}
+	for _, test := range tests {
+		_, diags := assembleSource(t, test.source)
+		if len(diags) == 0 || diags[0].Message != test.message {
+			t.Errorf("%q: got %v, want error %q", test.source, diags, test.message)
+		}
+	}
+}
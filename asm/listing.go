@@ -0,0 +1,183 @@
+package tisasm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	// listingRowSize is how many bytes are shown in each row.
+	listingRowSize = 6
+	// listingMaxRows is how many rows a statement takes at most, so big
+	// .fill or .incbin do not flood the listing.
+	listingMaxRows = 8
+	// unwritten marks memory reserved with .space.
+	unwritten = -1
+)
+
+// listingLine is a line of a source file.
+type listingLine struct {
+	file string
+	line int
+}
+
+// WriteListing writes each line of the sources next to the address and
+// the bytes it placed in memory, followed by the symbol table. Macro
+// calls are listed with the bytes of their expansion.
+func (program *Program) WriteListing(out io.Writer) error {
+	writer := bufio.NewWriter(out)
+	memory := program.memory()
+	statements := make(map[listingLine][]Statement)
+	for _, statement := range program.Statements {
+		token := sourceToken(statement.Token)
+		at := listingLine{token.File, token.Line}
+		statements[at] = append(statements[at], statement)
+	}
+	for _, file := range program.Files {
+		fmt.Fprintf(writer, "; %s\n", file)
+		lines := bytes.Split(program.Sources[file], []byte("\n"))
+		if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+			lines = lines[:len(lines)-1]
+		}
+		for i, text := range lines {
+			number := i + 1
+			rows := listingRows(joinStatements(statements[listingLine{file, number}]), memory)
+			text := strings.TrimRight(string(text), "\r")
+			if len(rows) == 0 {
+				rows = []string{""}
+			}
+			fmt.Fprintf(writer, "%5d %-24s %s\n", number, rows[0], text)
+			for _, row := range rows[1:] {
+				fmt.Fprintf(writer, "%5s %s\n", "", row)
+			}
+		}
+		fmt.Fprintln(writer)
+	}
+	program.writeSymbolTable(writer)
+	return writer.Flush()
+}
+
+// sourceToken is the token written by the user that token comes from:
+// the outermost macro call for tokens of expansions.
+func sourceToken(token Token) Token {
+	for token.Expansion != nil {
+		token = token.Expansion.Call
+	}
+	return token
+}
+
+// joinStatements joins the statements of a line that are next to each
+// other in memory, like a tag and the instruction after it.
+func joinStatements(statements []Statement) []Statement {
+	joined := []Statement{}
+	for _, statement := range statements {
+		last := len(joined) - 1
+		if last >= 0 && int(joined[last].Address)+joined[last].Size == int(statement.Address) {
+			joined[last].Size += statement.Size
+			continue
+		}
+		joined = append(joined, statement)
+	}
+	return joined
+}
+
+// listingRows formats the address and bytes of the statements, in rows of
+// listingRowSize bytes.
+func listingRows(statements []Statement, memory []int) []string {
+	rows := []string{}
+	for _, statement := range statements {
+		start := int(statement.Address)
+		end := minInt(start+statement.Size, MemoryLimit)
+		if !isWritten(memory[start:end]) {
+			rows = append(rows, fmt.Sprintf("%04x", start))
+			continue
+		}
+		for address, count := start, 0; address < end; address, count = address+listingRowSize, count+1 {
+			if count == listingMaxRows {
+				rows = append(rows, fmt.Sprintf("%04x ... %d more bytes", address, end-address))
+				break
+			}
+			row := []string{}
+			for _, value := range memory[address:minInt(address+listingRowSize, end)] {
+				if value == unwritten {
+					row = append(row, "--")
+				} else {
+					row = append(row, fmt.Sprintf("%02x", value))
+				}
+			}
+			rows = append(rows, fmt.Sprintf("%04x %s", address, strings.Join(row, " ")))
+		}
+	}
+	return rows
+}
+
+func isWritten(memory []int) bool {
+	for _, value := range memory {
+		if value != unwritten {
+			return true
+		}
+	}
+	return false
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// memory is what the loader writes from the program, with unwritten in
+// the addresses that it does not touch.
+func (program *Program) memory() []int {
+	memory := make([]int, MemoryLimit)
+	for i := range memory {
+		memory[i] = unwritten
+	}
+	for _, entry := range program.Data {
+		for i := 0; i < entry.size(); i++ {
+			var value byte
+			switch {
+			case entry.Type == FillType:
+				value = entry.Value[0]
+			case i < len(entry.Value):
+				value = entry.Value[i]
+			}
+			memory[(int(entry.Address)+i)%MemoryLimit] = int(value)
+		}
+	}
+	for _, segment := range program.Segments {
+		for i, value := range segment.Code {
+			memory[(int(segment.Origin)+i)%MemoryLimit] = int(value)
+		}
+	}
+	return memory
+}
+
+// writeSymbolTable lists the symbols sorted by name. Anonymous tags are
+// left out, since their names cannot be written.
+func (program *Program) writeSymbolTable(out io.Writer) {
+	names := make([]string, 0, len(program.Symbols))
+	for name := range program.Symbols {
+		if !strings.HasPrefix(name, anonymousPrefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	fmt.Fprintln(out, "; Symbols")
+	for _, name := range names {
+		symbol := program.Symbols[name]
+		fmt.Fprintf(out, "%-24s %-8s $%04x  %s\n", symbol.Name, symbol.Kind, symbol.Value, symbol.Token.position())
+	}
+}
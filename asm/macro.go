@@ -0,0 +1,168 @@
+package tisasm
+
+import (
+	"fmt"
+	"strings"
+)
+
+const maxMacroDepth = 32
+
+// macro is a named list of tokens that is copied wherever it is called,
+// replacing its parameters by the arguments of the call.
+type macro struct {
+	name   Token
+	params []Token
+	body   []Token
+}
+
+// parseMacro reads a macro definition until .endm. The body is kept
+// as tokens and only parsed when the macro is called.
+func (prs *Parser) parseMacro(directive Token) {
+	header := prs.scanLine(directive)
+	body := []Token{}
+	token := prs.scan()
+	for !token.IsType(TokenEof) && !isDirective(token, ".endm") {
+		if isDirective(token, ".macro") {
+			prs.fail(token, "Macros cannot be defined inside another macro")
+		}
+		body = append(body, token)
+		token = prs.scan()
+	}
+	if token.IsType(TokenEof) {
+		prs.fail(directive, "Expected .endm at the end of the macro")
+	}
+	if len(header) == 0 || !header[0].IsType(TokenInstruction) {
+		prs.fail(directive, "Expected macro name after .macro")
+	}
+	name := header[0]
+	if _, err := GetInstruction(strings.ToLower(name.Literal)); err == nil {
+		prs.failf(name, "Instruction %s cannot be used as a macro name", name.Literal)
+	}
+	if previous, ok := prs.macros[name.Literal]; ok {
+		prs.failf(name, "Macro %s is already defined at %s", name.Literal, previous.name.position())
+	}
+	params := []Token{}
+	for _, param := range prs.splitArguments(name, header[1:]) {
+		if len(param) != 1 || !param[0].IsType(TokenInstruction) {
+			prs.fail(param[0], "Expected macro parameter name")
+		}
+		params = append(params, param[0])
+	}
+	prs.macros[name.Literal] = macro{name, params, body}
+}
+
+func isDirective(token Token, literal string) bool {
+	return token.IsType(TokenDirective) && token.Literal == literal
+}
+
+func (prs *Parser) isMacroCall(token Token) bool {
+	_, ok := prs.macros[token.Literal]
+	return token.IsType(TokenInstruction) && ok
+}
+
+// expandMacro reads the arguments of a macro call and places the body of
+// the macro in front of the tokens left to scan. Tags defined inside the
+// macro are renamed, so each call gets its own.
+func (prs *Parser) expandMacro(call Token) {
+	mcr := prs.macros[call.Literal]
+	args := prs.splitArguments(call, prs.scanLine(call))
+	if len(args) != len(mcr.params) {
+		prs.failf(call, "Macro %s expects %d arguments, but %d were given", call.Literal, len(mcr.params), len(args))
+	}
+	if expansionDepth(call) >= maxMacroDepth {
+		prs.failf(call, "Macro %s expands too deep, is it calling itself?", call.Literal)
+	}
+	prs.expansions++
+	expansion := &Expansion{Macro: call.Literal, Call: call}
+	locals := make(map[string]string)
+	for _, token := range mcr.body {
+		if token.IsType(TokenTag) && token.Literal != "" && !isAnonymousReference(token.Literal) {
+			locals[token.Literal] = fmt.Sprintf("%s@%s%d", token.Literal, call.Literal, prs.expansions)
+		}
+	}
+	tokens := []Token{}
+	for _, token := range mcr.body {
+		if index := indexOfParam(mcr.params, token); index >= 0 {
+			for _, arg := range args[index] {
+				tokens = append(tokens, placeAt(arg, token, expansion))
+			}
+			continue
+		}
+		if local, ok := locals[token.Literal]; ok && token.IsAnyTypeOf(TokenTag, TokenInstruction, TokenDirective) {
+			token.Literal = local
+		}
+		token.Expansion = expansion
+		tokens = append(tokens, token)
+	}
+	prs.pushScanner(newTokenScanner(tokens, call))
+}
+
+func expansionDepth(token Token) int {
+	depth := 0
+	for expansion := token.Expansion; expansion != nil; expansion = expansion.Call.Expansion {
+		depth++
+	}
+	return depth
+}
+
+func indexOfParam(params []Token, token Token) int {
+	if !token.IsType(TokenInstruction) {
+		return -1
+	}
+	for i, param := range params {
+		if param.Literal == token.Literal {
+			return i
+		}
+	}
+	return -1
+}
+
+// placeAt moves an argument to where the parameter was written in the
+// macro body, so it is read as part of that line.
+func placeAt(arg Token, param Token, expansion *Expansion) Token {
+	arg.File = param.File
+	arg.Line = param.Line
+	arg.Column = param.Column
+	arg.Offset = param.Offset
+	arg.Length = param.Length
+	arg.Expansion = expansion
+	return arg
+}
+
+// scanLine reads the rest of the tokens written in the same line as start.
+func (prs *Parser) scanLine(start Token) []Token {
+	tokens := []Token{}
+	token := prs.scan()
+	for isSameLine(token, start) {
+		tokens = append(tokens, token)
+		token = prs.scan()
+	}
+	prs.unread(token)
+	return tokens
+}
+
+// splitArguments splits a comma separated list. None of the elements
+// can be empty.
+func (prs *Parser) splitArguments(start Token, tokens []Token) [][]Token {
+	if len(tokens) == 0 {
+		return nil
+	}
+	args := [][]Token{{}}
+	previous := start
+	for _, token := range tokens {
+		last := len(args) - 1
+		if token.IsType(TokenComma) {
+			if len(args[last]) == 0 {
+				prs.fail(token, "Expected argument before ','")
+			}
+			args = append(args, []Token{})
+		} else {
+			args[last] = append(args[last], token)
+		}
+		previous = token
+	}
+	if len(args[len(args)-1]) == 0 {
+		prs.fail(previous, "Expected argument after ','")
+	}
+	return args
+}
@@ -0,0 +1,68 @@
+package tisasm
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMacroExpansion(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expanded string
+	}{
+		{
+			"parameters",
+			".macro put reg, value\n movi value reg\n tar reg\n.endm\n.code $0200\n put R1, 5\n put R2, 2+3\n",
+			".code $0200\n movi 5 R1\n tar R1\n movi 2+3 R2\n tar R2\n",
+		},
+		{
+			"address parameter",
+			".macro go to\n jmp to\n.endm\n.code $0200\n:start go start\n go end\n:end hlt\n",
+			".code $0200\n:start jmp start\n jmp end\n:end hlt\n",
+		},
+		{
+			"tags of each call",
+			".macro wait\n:loop jne loop\n.endm\n.code $0200\n wait\n wait\n",
+			".code $0200\n:a jne a\n:b jne b\n",
+		},
+		{
+			"macro calling a macro",
+			".macro one r\n movi 1 r\n.endm\n.macro two a, b\n one a\n one b\n.endm\n.code $0200\n two R1, R2\n",
+			".code $0200\n movi 1 R1\n movi 1 R2\n",
+		},
+	}
+	for _, test := range tests {
+		program, diags := assembleSource(t, test.source)
+		expanded, expandedDiags := assembleSource(t, test.expanded)
+		if len(diags) > 0 || len(expandedDiags) > 0 {
+			t.Errorf("%s: unexpected diagnostics %v %v", test.name, diags, expandedDiags)
+			continue
+		}
+		if rom, want := program.rom(false), expanded.rom(false); !bytes.Equal(rom, want) {
+			t.Errorf("%s: got % x, want % x", test.name, rom, want)
+		}
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	tests := []struct {
+		source  string
+		message string
+	}{
+		{".macro m a\n.endm\n.code $0200\n m\n", "Macro m expects 1 arguments, but 0 were given"},
+		{".macro m\n m\n.endm\n.code $0200\n m\n", "Macro m expands too deep, is it calling itself?"},
+		{".macro m\n.endm\n.macro m\n.endm\n", "Macro m is already defined at test.asm:1"},
+		{".macro hlt\n.endm\n", "Instruction hlt cannot be used as a macro name"},
+		{".macro m\n.code $0200\n", "Expected .endm at the end of the macro"},
+		{".macro m\n jmp :done\n:done hlt\n.endm\n.code $0200\n m\n", "Tags are used without ':', write done"},
+		{".macro m\n jmp out\n.endm\n.code $0200\n m\n", "Expected tag out to be defined"},
+		{".code $0200\n jmp :\n", "Expected :+ or :- to use an anonymous tag, ':' alone defines one"},
+	}
+	for _, test := range tests {
+		_, diags := assembleSource(t, test.source)
+		if len(diags) == 0 || diags[0].Message != test.message {
+			t.Errorf("%q: got %v, want error %q", test.source, diags, test.message)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package tisasm
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+)
+
+// DecodeRange makes the diassembler decode only the memory from start to
+// end, both included, when it reads a memory dump. The range is cut to the
+// memory in the dump, which is all decoded by default.
+func (dasm *Diassembler) DecodeRange(start, end uint16) {
+	dasm.limited = true
+	dasm.start = start
+	dasm.end = end
+}
+
+// DiasembleRaw reads the input as raw memory loaded from base, without
+// sections, and decodes it as a single code segment.
+func (dasm *Diassembler) DiasembleRaw(base uint16) (*Disassembly, []Diagnostic) {
+	dasm.dis = &Disassembly{}
+	dasm.readMemory(func() (uint16, []byte) {
+		memory := []byte{}
+		for {
+			b := dasm.readByte()
+			if dasm.eof {
+				return base, memory
+			}
+			memory = append(memory, b)
+		}
+	})
+	return dasm.finish()
+}
+
+// DiasembleHexDump reads the input as the memory rows that the console
+// emulator writes in its status, like
+//
+//	$4100: 39 50 00 01 00 39 30 00 01 02 40 04 43 00 00 00
+//
+// and decodes them as a single code segment. The rows must follow each
+// other, and the other lines are skipped, so a whole status can be read.
+func (dasm *Diassembler) DiasembleHexDump() (*Disassembly, []Diagnostic) {
+	dasm.dis = &Disassembly{}
+	dasm.readMemory(func() (uint16, []byte) {
+		var base uint16
+		memory := []byte{}
+		scanner := bufio.NewScanner(dasm.in)
+		for line := 1; scanner.Scan(); line++ {
+			address, row, ok := dasm.parseDumpRow(scanner.Text(), line)
+			if !ok {
+				continue
+			}
+			if len(memory) == 0 {
+				base = address
+			} else if int(address) != int(base)+len(memory) {
+				dasm.failAt(line, "Expected row at $%04x, but it is at $%04x", int(base)+len(memory), address)
+			}
+			memory = append(memory, row...)
+		}
+		if err := scanner.Err(); err != nil {
+			dasm.failf("Error while reading file: %s", err)
+		}
+		return base, memory
+	})
+	return dasm.finish()
+}
+
+// readMemory reads the memory of a dump and the address it starts, and
+// decodes the range of it as a segment.
+func (dasm *Diassembler) readMemory(read func() (uint16, []byte)) {
+	defer catchDiagnostic(&dasm.diags)
+	base, memory := read()
+	if len(memory) == 0 {
+		dasm.fail("There is no memory in the dump")
+	}
+	last := int(base) + len(memory) - 1
+	if last > 0xffff {
+		dasm.failf("Dump loaded at $%04x ends after $ffff", base)
+	}
+	start, end := int(base), last
+	if dasm.limited {
+		if dasm.start > dasm.end {
+			dasm.failf("Range $%04x-$%04x starts after its end", dasm.start, dasm.end)
+		}
+		if int(dasm.start) > last || int(dasm.end) < int(base) {
+			dasm.failf("Range $%04x-$%04x is outside the dump, that has $%04x-$%04x", dasm.start, dasm.end, base, last)
+		}
+		start, end = maxInt(start, int(dasm.start)), minInt(end, int(dasm.end))
+	}
+	dasm.decodeSegment(uint16(start), memory[start-int(base):end-int(base)+1])
+}
+
+// parseDumpRow parses a line of a hex dump. Lines that are not a row are
+// not ok, but rows with bytes that are not hexadecimal fail.
+func (dasm *Diassembler) parseDumpRow(text string, line int) (uint16, []byte, bool) {
+	text = strings.TrimSpace(text)
+	colon := strings.Index(text, ":")
+	if !strings.HasPrefix(text, "$") || colon < 0 {
+		return 0, nil, false
+	}
+	address, err := strconv.ParseUint(text[1:colon], 16, 16)
+	if err != nil {
+		return 0, nil, false
+	}
+	row := []byte{}
+	for _, field := range strings.Fields(text[colon+1:]) {
+		value, err := strconv.ParseUint(field, 16, 8)
+		if err != nil || len(field) != 2 {
+			dasm.failAt(line, "Expected byte as two hexadecimal digits, but found %s", field)
+		}
+		row = append(row, byte(value))
+	}
+	return uint16(address), row, true
+}
+
+func (dasm *Diassembler) finish() (*Disassembly, []Diagnostic) {
+	if dasm.follow {
+		dasm.diags = append(dasm.diags, dasm.dis.followControlFlow(dasm.name)...)
+	}
+	return dasm.dis, dasm.diags
+}
+
+func (dasm *Diassembler) failAt(line int, format string, replaces ...interface{}) {
+	diag := newDiagnostic(dasm.name, format, replaces...)
+	diag.Line = line
+	bail(diag)
+}
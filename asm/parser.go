@@ -1,194 +1,517 @@
 package tisasm
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
-	"os"
 	"strconv"
+	"strings"
 )
 
 const MemoryLimit int = 65536
 
+// RegisterMax is the last general purpose register of the CPU.
+const RegisterMax int = 15
+
 type Parser struct {
-	scanner Scanner
-	out     *os.File
-	tags    map[string]string
+	scanner      *scannerStack
+	program      *Program
+	fixups       []fixup
+	macros       map[string]macro
+	expansions   int
+	conditionals []conditional
+	section      string
+	scope        string
+	dataAddress  int
+	anonymous    int
+	regions      []region
+	includeDirs  []string
+	diags        []Diagnostic
+	last         Token
+	pending      []Token
+}
+
+// fixup is an operand that uses tags before they are defined. It is
+// evaluated and patched at offset into the code of the segment, or into
+// the value of the data entry, once the whole file is parsed.
+type fixup struct {
+	data   bool
+	index  int
+	offset int
+	width  int
+	expr   expression
+}
+
+func NewParser(scanner Scanner) *Parser {
+	return &Parser{
+		scanner: newScannerStack(scanner),
+		program: &Program{
+			Symbols: make(map[string]Symbol),
+			Sources: make(SourceFiles),
+		},
+		macros:      make(map[string]macro),
+		dataAddress: -1,
+	}
+}
+
+// Parse builds the program in a single pass. Errors do not stop the
+// parser: it resumes at the next line and keeps reporting.
+func (prs *Parser) Parse() (*Program, []Diagnostic) {
+	prs.parse()
+	prs.checkCode()
+	prs.checkConditionals()
+	prs.resolveFixups()
+	prs.checkOverlaps()
+	sortDiagnostics(prs.diags, prs.program.Files)
+	return prs.program, prs.diags
 }
 
-func NewParser(scanner Scanner, out *os.File, tags map[string]string) Parser {
-	return Parser{
-		scanner,
-		out,
-		tags,
+func (prs *Parser) parse() {
+	defer catchDiagnostic(&prs.diags)
+	token := prs.scan()
+	for !token.IsType(TokenEof) {
+		mark := prs.mark()
+		prs.parseStatement(token, prs.parseSourceStatement)
+		prs.recordStatement(token, mark)
+		token = prs.scan()
 	}
 }
 
-func (prs Parser) Parse() {
-	token := prs.scanner.Scan()
-	if token.TokenType != TokenSection {
-		ShowErrorToken(token, "Expected start of section in top of file")
+// statementMark is where the memory used by the parser ended before a
+// statement.
+type statementMark struct {
+	segments int
+	code     int
+	regions  int
+}
+
+func (prs *Parser) mark() statementMark {
+	mark := statementMark{len(prs.program.Segments), 0, len(prs.regions)}
+	if mark.segments > 0 {
+		mark.code = len(prs.segment().Code)
+	}
+	return mark
+}
+
+// recordStatement adds to the program the memory used by the statement
+// that started at token, since mark.
+func (prs *Parser) recordStatement(token Token, mark statementMark) {
+	for _, reg := range prs.regions[mark.regions:] {
+		prs.program.Statements = append(prs.program.Statements, Statement{token, uint16(reg.start), reg.size})
+	}
+	if prs.section != ".code" || len(prs.program.Segments) != mark.segments || mark.segments == 0 {
+		return
 	}
+	size := len(prs.segment().Code) - mark.code
+	if size > 0 || token.IsType(TokenTag) {
+		prs.program.Statements = append(prs.program.Statements, Statement{token, prs.segment().address(mark.code), size})
+	}
+}
+
+// parseSourceStatement parses a statement of the section being read.
+// Sections can be written any number of times and in any order.
+func (prs *Parser) parseSourceStatement(token Token) {
+	switch {
+	case token.IsType(TokenSection):
+		prs.parseSection(token)
+	case token.IsType(TokenDirective):
+		prs.parseDirective(token)
+	case prs.isMacroCall(token):
+		prs.expandMacro(token)
+	case prs.section == ".data":
+		prs.parseDataEntry(token)
+	case prs.section == ".code":
+		prs.parseCodeStatement(token)
+	default:
+		prs.fail(token, "Expected start of section before this line")
+	}
+}
+
+func (prs *Parser) parseSection(token Token) {
 	switch token.Literal {
 	case ".data":
-		prs.parseDataSection()
+		prs.section = token.Literal
 	case ".code":
-		prs.parseCodeSection()
+		prs.emitCodeSection(token)
+		prs.section = token.Literal
 	default:
-		ShowErrorTokenf(token, "Unknown section %s in top of file", token.Literal)
+		prs.failf(token, "Unknown section %s", token.Literal)
 	}
 }
 
-func (prs Parser) parseDataSection() {
-	prs.emitDataSection()
-	token := prs.scanner.Scan()
-	for token.IsCorrect() && !token.IsType(TokenSection) {
-		if !token.IsType(TokenMemory) {
-			ShowErrorToken(token, "Expected memory address inside data section")
-		}
-		prs.emitMemory(token)
-		token = prs.scanner.Scan()
-		switch token.TokenType {
-		case TokenString, TokenChar:
-			prs.emitBytes(0x01)
-			prs.emitASCII(token)
-		case TokenNumber, TokenHex:
-			prs.emitBytes(0x02)
-			prs.emitNumber(token)
-		default:
-			ShowErrorToken(token, "Expected number or string after memory address inside data section")
+// parseDataEntry parses an address followed by a value or by a data
+// directive. Data directives can omit the address to be placed after the
+// previous entry.
+func (prs *Parser) parseDataEntry(token Token) {
+	tag := token
+	if tag.IsType(TokenTag) {
+		token = prs.scan()
+	}
+	if !isDataDirective(token) {
+		prs.dataAddress = prs.immediateValue(token, 2)
+		token = prs.scan()
+	} else if prs.dataAddress < 0 {
+		prs.failf(token, "Expected address before %s, there is no previous data entry", token.Literal)
+	}
+	if tag.IsType(TokenTag) {
+		prs.define(prs.globalTag(tag), SymbolData, uint16(prs.dataAddress))
+	}
+	if isDataDirective(token) {
+		prs.parseDataDirective(token)
+		return
+	}
+	entry := DataEntry{Address: uint16(prs.dataAddress)}
+	switch token.TokenType {
+	case TokenString, TokenChar:
+		entry.Type = StringType
+		entry.Value = []byte(token.Literal)
+		if bytes.IndexByte(entry.Value, 0x00) >= 0 {
+			// The loader ends strings at the first 0x00
+			entry.Type = BlockType
 		}
-		token = prs.scanner.Scan()
+	default:
+		entry.Type = NumberType
+		entry.Value = []byte{byte(prs.immediateValue(token, 1))}
 	}
-	if !token.IsSection(".code") {
-		ShowErrorToken(token, "Expected .code section after .data section")
+	prs.program.Data = append(prs.program.Data, entry)
+	prs.regions = append(prs.regions, region{int(entry.Address), entry.size(), tag})
+	prs.dataAddress += entry.size()
+}
+
+func (prs *Parser) parseCodeStatement(token Token) {
+	switch token.TokenType {
+	case TokenTag:
+		prs.defineLabel(token)
+	case TokenInstruction:
+		prs.parseInstruction(token)
+		prs.checkMemoryLimit(token)
+	default:
+		prs.failf(token, "Expected instruction but have %s '%s'", token.TokenType, token.Literal)
 	}
-	prs.emitBytes(0x00, 0x00, 0x00)
-	prs.parseCodeSection()
 }
 
-func (prs Parser) parseCodeSection() {
-	prs.emitCodeSection()
-	token := prs.scanner.Scan()
-	for token.IsCorrect() {
-		switch token.TokenType {
-		case TokenTag: // Do nothing
-		case TokenInstruction:
-			prs.parseInstruction(token)
-		default:
-			ShowErrorTokenf(token, "Expected instruction but have %s", token)
-		}
-		token = prs.scanner.Scan()
+func (prs *Parser) parseDirective(token Token) {
+	switch token.Literal {
+	case ".equ", ".define":
+		prs.parseConstant(token)
+	case ".if", ".ifdef", ".ifndef":
+		prs.parseIf(token)
+	case ".else":
+		prs.parseElse(token)
+	case ".endif":
+		prs.parseEndif(token)
+	case ".byte", ".word", ".fill", ".space", ".ascii", ".asciz", ".incbin":
+		prs.parseDataDirective(token)
+	case ".include":
+		prs.parseInclude(token)
+	case ".macro":
+		prs.parseMacro(token)
+	case ".endm":
+		prs.fail(token, "Found .endm without .macro")
+	default:
+		prs.failf(token, "Unknown directive %s", token.Literal)
 	}
-	if token.IsType(TokenError) {
-		ShowErrorTokenf(token, "Error while reading section code %s", token)
+}
+
+// parseConstant defines a name for a number, a memory address or a
+// register. Constants are local to the file being assembled.
+func (prs *Parser) parseConstant(directive Token) {
+	name := prs.scan()
+	if !name.IsType(TokenInstruction) {
+		prs.failf(name, "Expected constant name after %s", directive.Literal)
+	}
+	if _, err := GetInstruction(strings.ToLower(name.Literal)); err == nil {
+		prs.failf(name, "Instruction %s cannot be used as a constant name", name.Literal)
+	}
+	value := prs.scan()
+	if value.IsType(TokenRegister) || prs.isRegisterConstant(value) {
+		prs.define(name, SymbolRegister, uint16(prs.registerValue(value)))
+		return
 	}
+	prs.define(name, SymbolConstant, uint16(prs.immediateValue(value, 2)))
 }
 
-func (prs *Parser) parseInstruction(token Token) {
-	instruction := token.AsInstruction()
-	prs.emitBytes(instruction.OpCode)
-	instruction.ParseParams(*prs)
+func (prs *Parser) define(token Token, kind SymbolKind, value uint16) {
+	previous, ok := prs.program.Symbols[token.Literal]
+	if ok {
+		prs.failf(token, "%s is already defined at %s", token.Literal, previous.Token.position())
+	}
+	prs.program.Symbols[token.Literal] = Symbol{
+		Name:  token.Literal,
+		Kind:  kind,
+		Value: value,
+		Token: token,
+	}
+}
+
+func (prs *Parser) currentAddress() uint16 {
+	return prs.segment().address(len(prs.segment().Code))
 }
 
-func (prs *Parser) emitCodeSection() {
-	prs.emitSectionStart()
-	prs.emitBytes(0x01)
-	codeMemoryStart := prs.scanner.Scan()
-	if !codeMemoryStart.IsType(TokenMemory) {
-		ShowError("Expected code section start memory direction after .code section")
+func (prs *Parser) checkMemoryLimit(token Token) {
+	if int(prs.segment().Origin)+len(prs.segment().Code) > MemoryLimit {
+		prs.fail(token, "Memory limit exceed.")
 	}
-	prs.emitMemory(codeMemoryStart)
 }
 
-func (prs Parser) emitDataSection() {
-	prs.emitSectionStart()
-	prs.emitBytes(0x00)
+func (prs *Parser) resolveFixups() {
+	for _, fix := range prs.fixups {
+		value, err := fix.expr.evaluate(prs.program.Symbols)
+		if err == nil {
+			err = fitValue(fix.expr, value, fix.width)
+		}
+		if undefined, ok := err.(undefinedSymbol); ok {
+			err = newTokenDiagnostic(undefined.token, "%s", undefined)
+		}
+		if err != nil {
+			prs.diags = append(prs.diags, err.(Diagnostic))
+			continue
+		}
+		copy(prs.fixupTarget(fix)[fix.offset:], valueBytes(value, fix.width))
+	}
 }
 
-func (prs Parser) emitSectionStart() {
-	prs.emitBytes(0xff, 0xfe, 0xfe, 0xff)
+// fixupTarget is the memory that the fixup patches.
+func (prs *Parser) fixupTarget(fix fixup) []byte {
+	if fix.data {
+		return prs.program.Data[fix.index].Value
+	}
+	return prs.program.Segments[fix.index].Code
 }
 
-func (prs Parser) emitASCII(token Token) {
-	data := []byte(token.Literal)
-	prs.emitBytes(data...)
-	prs.emitBytes(0x00)
+// parseStatement parses a single statement. If it fails, the error is
+// recorded and the tokens left in the statement line are skipped.
+func (prs *Parser) parseStatement(start Token, parse func(Token)) {
+	defer prs.synchronize(start)
+	parse(start)
 }
 
-func (prs Parser) emitNumber(token Token) {
-	if token.IsType(TokenHex) {
-		prs.emitHex(token.Literal, 1)
+func (prs *Parser) synchronize(start Token) {
+	recovered := recover()
+	if recovered == nil {
 		return
 	}
-	if !token.IsType(TokenNumber) {
-		ShowErrorToken(token, "Expected token to be number")
+	diag, ok := recovered.(Diagnostic)
+	if !ok {
+		panic(recovered)
 	}
-	integer, err := strconv.Atoi(token.Literal)
+	prs.diags = append(prs.diags, diag)
+	if len(prs.pending) == 0 && !isSameLine(prs.last, start) {
+		// The statement already took a token from the next line
+		prs.unread(prs.last)
+		return
+	}
+	token := prs.scan()
+	for isSameLine(token, start) {
+		token = prs.scan()
+	}
+	prs.unread(token)
+}
+
+// isSameLine tells if both tokens are in the same line. The end of the
+// file is never in the same line as another token.
+func isSameLine(a, b Token) bool {
+	return isSameSource(a, b) && a.Line == b.Line && !a.IsType(TokenEof) && !b.IsType(TokenEof)
+}
+
+func (prs *Parser) scan() Token {
+	if len(prs.pending) > 0 {
+		last := len(prs.pending) - 1
+		prs.last = prs.pending[last]
+		prs.pending = prs.pending[:last]
+		return prs.last
+	}
+	prs.last = prs.scanner.Scan()
+	return prs.last
+}
+
+func (prs *Parser) unread(token Token) {
+	prs.pending = append(prs.pending, token)
+}
+
+// pushScanner makes the parser read from scn until it ends. Tokens already
+// read ahead are kept to be read after it.
+func (prs *Parser) pushScanner(scn Scanner) {
+	if len(prs.pending) > 0 {
+		tokens := []Token{}
+		for i := len(prs.pending) - 1; i >= 0; i-- {
+			tokens = append(tokens, prs.pending[i])
+		}
+		prs.scanner.push(newTokenScanner(tokens, prs.pending[0]))
+		prs.pending = nil
+	}
+	prs.scanner.push(scn)
+}
+
+func (prs *Parser) parseInstruction(token Token) {
+	instruction, err := token.AsInstruction()
 	if err != nil {
-		ShowErrorTokenf(token, "Expected register number, got %s", token)
+		prs.failf(token, "%s", err)
+	}
+	prs.emitBytes(instruction.OpCode)
+	prs.parseOperands(token, instruction)
+}
+
+// parseOperands emits the operands of the instruction, checking them
+// against the kinds the instruction expects. They must be in the same
+// line as the instruction.
+func (prs *Parser) parseOperands(token Token, instruction Instruction) {
+	for i, kind := range instruction.Operands {
+		operand := prs.scan()
+		if !isSameLine(operand, token) {
+			prs.unread(operand)
+			prs.failf(token, "Missing operand %d of %s, it must be %s", i+1, instruction.Literal, kind)
+		}
+		if !prs.isOperandOf(operand, kind) {
+			prs.failf(operand, "Operand %d of %s must be %s", i+1, instruction.Literal, kind)
+		}
+		if kind == OperandRegister {
+			prs.emitRegister(operand)
+		} else {
+			prs.emitExpression(operand, kind.Size())
+		}
 	}
-	if integer >= 256 {
-		ShowErrorToken(token, "Integer must be under 256")
+	next := prs.scan()
+	if isSameLine(next, token) {
+		prs.failf(next, "Too many operands, %s expects %d", instruction.Literal, len(instruction.Operands))
 	}
-	fixed := fmt.Sprintf("%02x", integer)
-	prs.emitHex(fixed, 1)
+	prs.unread(next)
 }
 
-func (prs Parser) emitJumpDest(token Token) {
-	switch token.TokenType {
-	case TokenMemory:
-		prs.emitMemory(token)
-	case TokenInstruction:
-		prs.emitTag(token)
-	default:
-		ShowErrorToken(token, "Expected jump destination to be a tag or memory address")
+// isOperandOf tells if the first token of an operand can start an operand
+// of the kind.
+func (prs *Parser) isOperandOf(token Token, kind OperandKind) bool {
+	isRegister := token.IsType(TokenRegister) || prs.isRegisterConstant(token)
+	if kind == OperandRegister {
+		return isRegister
 	}
+	return !isRegister && token.IsAnyTypeOf(
+		TokenNumber, TokenHex, TokenBinary, TokenChar, TokenMemory,
+		TokenLeftParen, TokenOperator, TokenInstruction, TokenDirective, TokenTag,
+	)
 }
 
-func (prs Parser) emitTag(token Token) {
-	if token.TokenType != TokenInstruction {
-		ShowErrorToken(token, "Expected tag")
+// emitExpression emits an operand of width bytes. Operands using tags that
+// are not defined yet are emitted as zero and patched at the end.
+func (prs *Parser) emitExpression(token Token, width int) {
+	expr, value, known := prs.operandValue(token, width)
+	if !known {
+		segment := len(prs.program.Segments) - 1
+		prs.fixups = append(prs.fixups, fixup{false, segment, len(prs.segment().Code), width, expr})
 	}
-	val, ok := prs.tags[token.Literal]
-	if !ok {
-		ShowErrorTokenf(token, "Expected tag %s to be defined", token.Literal)
+	prs.emitBytes(valueBytes(value, width)...)
+}
+
+// operandValue evaluates an operand of width bytes. When it uses tags
+// that are not defined yet, the value is zero and known is false.
+func (prs *Parser) operandValue(token Token, width int) (expr expression, value int, known bool) {
+	expr = prs.parseExpression(token)
+	value, err := expr.evaluate(prs.program.Symbols)
+	if _, ok := err.(undefinedSymbol); ok {
+		return expr, 0, false
 	}
-	prs.emitMemory(Token{
-		Literal:   val,
-		TokenType: TokenMemory,
-	})
+	prs.failOn(err)
+	prs.failOn(fitValue(expr, value, width))
+	return expr, value, true
 }
 
-func (prs Parser) emitRegister(token Token) {
-	integer, err := strconv.Atoi(token.Literal)
+// immediateValue evaluates an expression that must be known right away,
+// like addresses of the data section or constant values.
+func (prs *Parser) immediateValue(token Token, width int) int {
+	expr := prs.parseExpression(token)
+	value, err := expr.evaluate(prs.program.Symbols)
+	if undefined, ok := err.(undefinedSymbol); ok {
+		prs.failf(undefined.token, "%s must be defined before being used here", undefined.token.Literal)
+	}
+	prs.failOn(err)
+	prs.failOn(fitValue(expr, value, width))
+	return value
+}
+
+func valueBytes(value int, width int) []byte {
+	if width == 1 {
+		return []byte{byte(value)}
+	}
+	return []byte{byte(value >> 8), byte(value)}
+}
+
+func (prs *Parser) integerValue(token Token) uint16 {
+	var integer uint64
+	var err error
+	switch token.TokenType {
+	case TokenHex:
+		integer, err = strconv.ParseUint(token.Literal, 16, 16)
+	case TokenBinary:
+		integer, err = strconv.ParseUint(token.Literal, 2, 16)
+	case TokenNumber:
+		integer, err = strconv.ParseUint(token.Literal, 10, 16)
+	default:
+		prs.fail(token, "Expected token to be number")
+	}
 	if err != nil {
-		ShowErrorTokenf(token, "Error while decoding as number literal: %s", token.Literal)
+		prs.fail(token, "Expected number under 65536")
+	}
+	return uint16(integer)
+}
+
+func (prs *Parser) emitRegister(token Token) {
+	prs.emitBytes(prs.registerValue(token))
+}
+
+// registerValue reads a register, written as Rx or as a register constant.
+func (prs *Parser) registerValue(token Token) byte {
+	if prs.isRegisterConstant(token) {
+		return byte(prs.program.Symbols[token.Literal].Value)
 	}
-	if integer >= 256 {
-		ShowErrorToken(token, "Integer must be under 256")
+	if !token.IsType(TokenRegister) {
+		prs.fail(token, "Expected a register R0–R15")
+	}
+	integer, err := strconv.Atoi(token.Literal)
+	if err != nil || integer > RegisterMax {
+		prs.failf(token, "Register R%s does not exist, registers go from R0 to R%d", token.Literal, RegisterMax)
 	}
-	b := byte(integer & 0xff)
-	prs.emitBytes(b)
+	return byte(integer)
 }
 
-func (prs Parser) emitMemory(token Token) {
-	prs.emitHex(token.Literal, 2)
+func (prs *Parser) isRegisterConstant(token Token) bool {
+	symbol, ok := prs.program.Symbols[token.Literal]
+	return token.IsType(TokenInstruction) && ok && symbol.Kind == SymbolRegister
 }
 
-func (prs Parser) emitHex(literal string, length int) {
-	address, err := hex.DecodeString(literal)
+func (prs *Parser) memoryValue(token Token) uint16 {
+	return binary.BigEndian.Uint16(prs.hexValue(token, 2))
+}
+
+func (prs *Parser) hexValue(token Token, length int) []byte {
+	value, err := hex.DecodeString(token.Literal)
 	if err != nil {
-		ShowErrorf("Error while decoding as hexadecimal literal in emitHex: %s (%s). Maybe hexadecimal have odd length?", err, literal)
+		prs.failf(token, "Error while decoding as hexadecimal literal: %s (%s). Maybe hexadecimal have odd length?", err, token.Literal)
+	}
+	if len(value) != length {
+		prs.failf(token, "Expected hexadecimal to be %d length, have %d with literal %s", length, len(value), token.Literal)
 	}
-	if len(address) != length {
-		ShowErrorf("Expected hexadecimal to be %d length, have %d with literal %s\n", length, len(address), literal)
+	return value
+}
+
+func (prs *Parser) emitBytes(bytes ...byte) {
+	segment := prs.segment()
+	segment.Code = append(segment.Code, bytes...)
+}
+
+func (prs *Parser) fail(token Token, msg string) {
+	if token.IsType(TokenError) {
+		msg = token.Literal
 	}
-	prs.emitBytes(address...)
+	bail(newTokenDiagnostic(token, "%s", msg))
 }
 
-func (prs Parser) emitBytes(bytes ...byte) {
-	_, err := prs.out.Write(bytes)
+func (prs *Parser) failOn(err error) {
 	if err != nil {
-		panic(err)
+		bail(err.(Diagnostic))
 	}
 }
+
+func (prs *Parser) failf(token Token, format string, replaces ...interface{}) {
+	prs.fail(token, fmt.Sprintf(format, replaces...))
+}
@@ -0,0 +1,75 @@
+package tisasm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// assembleSource assembles the source as a file named test.asm.
+func assembleSource(t *testing.T, source string) (*Program, []Diagnostic) {
+	t.Helper()
+	return Assemble("test.asm", strings.NewReader(source), Options{})
+}
+
+func TestLiteralOperands(t *testing.T) {
+	tests := []struct {
+		source string
+		code   []byte
+	}{
+		{"movi 0 R1", []byte{0x33, 0, 1}},
+		{"movi 'A' R1", []byte{0x33, 'A', 1}},
+		{`movi '\n' R2`, []byte{0x33, '\n', 2}},
+		{"addi 'z'", []byte{0x02, 'z'}},
+		{`addi '\0'`, []byte{0x02, 0}},
+		{"addi 0b11111111", []byte{0x02, 0xff}},
+		{"addi 0xff", []byte{0x02, 0xff}},
+		{"jmp 65535", []byte{0x20, 0xff, 0xff}},
+	}
+	for _, test := range tests {
+		program, diags := assembleSource(t, ".code $0200\n"+test.source+"\n")
+		if len(diags) > 0 {
+			t.Errorf("%s: unexpected diagnostics %v", test.source, diags)
+			continue
+		}
+		if code := program.Segments[0].Code; !bytes.Equal(code, test.code) {
+			t.Errorf("%s: got % x, want % x", test.source, code, test.code)
+		}
+	}
+}
+
+func TestLiteralRangeErrors(t *testing.T) {
+	tests := []struct {
+		source  string
+		message string
+	}{
+		{".code $0200\naddi 256\n", "Value 256 does not fit in 8 bits (0-255)"},
+		{".code $0200\nmovi 0b100000000 R1\n", "Value 256 does not fit in 8 bits (0-255)"},
+		{".code $0200\njmp 0x10000\n", "Expected number under 65536"},
+		{".code $0200\njmp 65536\n", "Expected number under 65536"},
+		{".data\n$5000 0x100\n", "Value 256 does not fit in 8 bits (0-255)"},
+	}
+	for _, test := range tests {
+		_, diags := assembleSource(t, test.source)
+		if len(diags) == 0 || diags[0].Message != test.message {
+			t.Errorf("%q: got %v, want error %q", test.source, diags, test.message)
+		}
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	tests := []struct {
+		source  string
+		message string
+	}{
+		{"movi 1 R16", "Register R16 does not exist, registers go from R0 to R15"},
+		{"movi 1 R123", "Register R123 does not exist, registers go from R0 to R15"},
+		{"movi 1 R1x", "Register R1x does not exist, registers go from R0 to R15"},
+	}
+	for _, test := range tests {
+		_, diags := assembleSource(t, ".code $0200\n"+test.source+"\n")
+		if len(diags) != 1 || diags[0].Message != test.message {
+			t.Errorf("%s: got %v, want error %q", test.source, diags, test.message)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package tisasm
+
+import "io"
+
+const (
+	DataSectionByte      byte = 0x00
+	CodeSectoinByte           = 0x01
+	SizedCodeSectionByte      = 0x02
+	// DebugSectionByte is the first of the sections that the loader
+	// skips. They start with their size in four bytes.
+	DebugSectionByte = 0x03
+)
+
+const (
+	NumberType  byte = 0x02
+	StringType       = 0x01
+	SectionType      = 0x00
+	BlockType        = 0x03
+	FillType         = 0x04
+)
+
+var sectionStart = []byte{0xff, 0xfe, 0xfe, 0xff}
+
+// Program is an assembled source, ready to be written as a ROM.
+type Program struct {
+	Data       []DataEntry
+	Segments   []Segment
+	Symbols    map[string]Symbol
+	Sources    SourceFiles
+	Files      []string
+	Statements []Statement
+}
+
+// Statement is the memory placed by a statement of the source, in the
+// order they were parsed. Statements of macro expansions keep the tokens
+// of the macro. Tags of the code section are statements of size 0.
+type Statement struct {
+	Token   Token
+	Address uint16
+	Size    int
+}
+
+// Segment is the code of a .code section, loaded at Origin.
+type Segment struct {
+	Origin uint16
+	Code   []byte
+	Token  Token
+}
+
+func (segment *Segment) address(offset int) uint16 {
+	return segment.Origin + uint16(offset)
+}
+
+type SymbolKind string
+
+const (
+	SymbolLabel    SymbolKind = "label"
+	SymbolData     SymbolKind = "data"
+	SymbolConstant SymbolKind = "constant"
+	SymbolRegister SymbolKind = "register"
+)
+
+// Symbol is a name defined in the source. Value is the address of labels
+// and data entries, the number of constants and the index of registers.
+type Symbol struct {
+	Name  string
+	Kind  SymbolKind
+	Value uint16
+	Token Token
+}
+
+func (symbol Symbol) IsAddress() bool {
+	return symbol.Kind == SymbolLabel || symbol.Kind == SymbolData
+}
+
+// DataEntry is a value from the data section that the loader copies
+// to Address. Strings are stored without their ending 0x00. Fill entries
+// write their single byte of Value Count times.
+type DataEntry struct {
+	Address uint16
+	Type    byte
+	Value   []byte
+	Count   uint16
+}
+
+// size is the number of bytes the loader writes in memory, with the
+// 0x00 that ends strings.
+func (entry DataEntry) size() int {
+	switch entry.Type {
+	case FillType:
+		return int(entry.Count)
+	case StringType:
+		return len(entry.Value) + 1
+	}
+	return len(entry.Value)
+}
+
+func (program *Program) WriteROM(out io.Writer) error {
+	_, err := out.Write(program.rom(false))
+	return err
+}
+
+// WriteDebugROM writes the ROM with its debug info in a section that the
+// loader skips.
+func (program *Program) WriteDebugROM(out io.Writer) error {
+	_, err := out.Write(program.rom(true))
+	return err
+}
+
+func (program *Program) rom(debug bool) []byte {
+	rom := []byte{}
+	if debug {
+		// It goes first, so tools reading the ROM know the tags of
+		// the data too.
+		rom = append(rom, sectionStart...)
+		rom = append(rom, DebugSectionByte)
+		rom = append(rom, program.DebugInfo().debugSection()...)
+	}
+	if len(program.Data) > 0 {
+		rom = append(rom, sectionStart...)
+		rom = append(rom, DataSectionByte)
+		for _, entry := range program.Data {
+			rom = appendWord(rom, entry.Address)
+			rom = append(rom, entry.Type)
+			switch entry.Type {
+			case BlockType:
+				rom = appendWord(rom, uint16(len(entry.Value)))
+			case FillType:
+				rom = appendWord(rom, entry.Count)
+			}
+			rom = append(rom, entry.Value...)
+			if entry.Type == StringType {
+				rom = append(rom, 0x00)
+			}
+		}
+		rom = append(rom, 0x00, 0x00, SectionType)
+	}
+	segments := program.loadedSegments()
+	for i, segment := range segments {
+		rom = append(rom, sectionStart...)
+		if i == len(segments)-1 {
+			// The last segment takes the rest of the file, as ROMs
+			// with a single segment always did.
+			rom = append(rom, CodeSectoinByte)
+			rom = appendWord(rom, segment.Origin)
+		} else {
+			rom = append(rom, SizedCodeSectionByte)
+			rom = appendWord(rom, segment.Origin)
+			rom = appendWord(rom, uint16(len(segment.Code)))
+		}
+		rom = append(rom, segment.Code...)
+	}
+	return rom
+}
+
+// loadedSegments skips the empty segments, but keeps the first one if all
+// of them are empty.
+func (program *Program) loadedSegments() []Segment {
+	segments := []Segment{}
+	for _, segment := range program.Segments {
+		if len(segment.Code) > 0 {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 0 && len(program.Segments) > 0 {
+		return program.Segments[:1]
+	}
+	return segments
+}
+
+func appendWord(bytes []byte, word uint16) []byte {
+	return append(bytes, byte(word>>8), byte(word))
+}
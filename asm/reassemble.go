@@ -0,0 +1,161 @@
+package tisasm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// jumpMnemonics are the instructions whose address operands get a label
+// when they point to an instruction, since they are usually code.
+var jumpMnemonics = []string{"jmp", "jeq", "jne", "jgt", "jlt", "jfg", "cll", "movm"}
+
+// WriteSource writes the disassembly as source code that assembles into
+// the same ROM. Addresses of jumps to instructions get L_xxxx labels,
+// unless the symbols or the debug info have a name for them.
+func (formatter *TextFormatter) WriteSource(out io.Writer, dis *Disassembly) error {
+	if formatter.debug == nil && dis.Debug != nil {
+		formatter.UseDebugInfo(*dis.Debug)
+	}
+	labels := formatter.sourceLabels(dis)
+	defined := make(map[uint16]bool)
+	writer := bufio.NewWriter(out)
+	if len(dis.Data) > 0 {
+		fmt.Fprintln(writer, ".data")
+		for _, entry := range dis.Data {
+			formatter.writeSourceDataEntry(writer, entry, labels, defined)
+		}
+		fmt.Fprintln(writer)
+	}
+	for i, segment := range dis.Segments {
+		if i > 0 {
+			fmt.Fprintln(writer)
+		}
+		fmt.Fprintf(writer, ".code $%04x\n", segment.Origin)
+		for _, ins := range segment.Instructions {
+			if !defined[ins.Address] {
+				for _, label := range labels[ins.Address] {
+					fmt.Fprintf(writer, ":%s\n", label)
+				}
+				defined[ins.Address] = true
+			}
+			fmt.Fprintf(writer, "\t%-28s ; $%04x\n", sourceInstruction(ins, labels), ins.Address)
+		}
+	}
+	return writer.Flush()
+}
+
+// sourceLabels finds the names of the addresses that can be defined in
+// the source: those of the start of instructions and data entries.
+func (formatter *TextFormatter) sourceLabels(dis *Disassembly) map[uint16][]string {
+	instructions := make(map[uint16]bool)
+	for _, ins := range dis.Instructions() {
+		instructions[ins.Address] = true
+	}
+	entries := make(map[uint16]bool)
+	for _, entry := range dis.Data {
+		entries[entry.Address] = true
+	}
+	labels := make(map[uint16][]string)
+	for address, tags := range formatter.tags {
+		if !instructions[address] && !entries[address] {
+			continue
+		}
+		for _, tag := range tags {
+			if isWritableName(tag) {
+				labels[address] = append(labels[address], tag)
+			}
+		}
+	}
+	for _, ins := range dis.Instructions() {
+		if !containsString(jumpMnemonics, ins.Mnemonic) {
+			continue
+		}
+		for _, operand := range ins.Operands {
+			target := uint16(operand.Value)
+			if operand.Kind == OperandAddress && instructions[target] && len(labels[target]) == 0 {
+				labels[target] = []string{fmt.Sprintf("L_%04x", target)}
+			}
+		}
+	}
+	return labels
+}
+
+// isWritableName tells if the name can be written as a tag, since symbols
+// of macros have names that cannot.
+func isWritableName(name string) bool {
+	if _, err := GetInstruction(strings.ToLower(name)); err == nil {
+		return false
+	}
+	return isTagName(name) && !isRegisterName(name)
+}
+
+func (formatter *TextFormatter) writeSourceDataEntry(out io.Writer, entry DataEntry, labels map[uint16][]string, defined map[uint16]bool) {
+	if !defined[entry.Address] {
+		for _, label := range labels[entry.Address] {
+			fmt.Fprintf(out, ":%s ", label)
+		}
+		defined[entry.Address] = true
+	}
+	fmt.Fprintf(out, "$%04x ", entry.Address)
+	switch {
+	case entry.Type == NumberType:
+		fmt.Fprintf(out, "%d", entry.Value[0])
+	case entry.Type == StringType || bytes.IndexByte(entry.Value, 0x00) >= 0:
+		// Strings with 0x00 are blocks, but they are not joined with
+		// the block before them as .byte would be.
+		fmt.Fprint(out, quoteString(entry.Value))
+	case entry.Type == BlockType:
+		writeBlock(out, entry)
+	case entry.Type == FillType:
+		fmt.Fprintf(out, ".fill %d, %d", entry.Count, entry.Value[0])
+	}
+	fmt.Fprintln(out)
+}
+
+// sourceInstruction writes the instruction using the labels of its
+// addresses.
+func sourceInstruction(ins DecodedInstruction, labels map[uint16][]string) string {
+	if ins.Mnemonic == "" {
+		return ins.String()
+	}
+	text := ins.Mnemonic
+	for _, operand := range ins.Operands {
+		if names := labels[uint16(operand.Value)]; operand.Kind == OperandAddress && len(names) > 0 {
+			text += " " + names[0]
+		} else {
+			text += " " + operand.String()
+		}
+	}
+	return text
+}
+
+// quoteString writes the bytes as a string literal, with escape sequences
+// for the bytes that are not printable.
+func quoteString(value []byte) string {
+	var builder strings.Builder
+	builder.WriteByte('"')
+	for _, c := range value {
+		switch {
+		case c == '\n':
+			builder.WriteString(`\n`)
+		case c == '\t':
+			builder.WriteString(`\t`)
+		case c == '\r':
+			builder.WriteString(`\r`)
+		case c == 0x00:
+			builder.WriteString(`\0`)
+		case c == '\\' || c == '"':
+			builder.WriteByte('\\')
+			builder.WriteByte(c)
+		case c >= 0x20 && c < 0x7f:
+			builder.WriteByte(c)
+		default:
+			fmt.Fprintf(&builder, `\x%02x`, c)
+		}
+	}
+	builder.WriteByte('"')
+	return builder.String()
+}
@@ -0,0 +1,36 @@
+package tisasm
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteSourceAssemblesSameROM(t *testing.T) {
+	sources := []string{
+		".code $0200\nmovi 1 R15\nadd R3\nhlt\n",
+		".code $0200\n.byte 0x01, 0xff\nhlt\n",
+		".code $0200\n.byte 0x33, 7, 16\ncrn\n",
+		".code $0200\n:start jmp start\n.byte 0x36, 0x50, 0x00, 0x20\n",
+		".data\n$5000 \"a\\tb\\0\"\n.code $4100\nmovm $5000 $0100\nint 4\ncrn\n",
+	}
+	for _, source := range sources {
+		program, diags := assembleSource(t, source)
+		if HasErrors(diags) {
+			t.Fatalf("%q: %v", source, diags)
+		}
+		rom := program.rom(false)
+		dis, diags := NewDiassembler("test.rom", bytes.NewReader(rom)).Diasemble()
+		if HasErrors(diags) {
+			t.Errorf("%q: diassembling failed: %v", source, diags)
+			continue
+		}
+		var written bytes.Buffer
+		if err := NewTextFormatter().WriteSource(&written, dis); err != nil {
+			t.Fatal(err)
+		}
+		again, diags := assembleSource(t, written.String())
+		if HasErrors(diags) || !bytes.Equal(again.rom(false), rom) {
+			t.Errorf("%q: reassembled\n%s\nas % x %v, want % x", source, written.String(), again.rom(false), diags, rom)
+		}
+	}
+}
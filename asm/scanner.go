@@ -2,5 +2,50 @@ package tisasm
 
 type Scanner interface {
 	Scan() Token
-	Advance(times int)
+}
+
+// tokenScanner reads tokens that were already scanned, like the body of
+// a macro expansion.
+type tokenScanner struct {
+	tokens []Token
+	eof    Token
+}
+
+func newTokenScanner(tokens []Token, eof Token) *tokenScanner {
+	eof.TokenType = TokenEof
+	return &tokenScanner{tokens, eof}
+}
+
+func (scn *tokenScanner) Scan() Token {
+	if len(scn.tokens) == 0 {
+		return scn.eof
+	}
+	token := scn.tokens[0]
+	scn.tokens = scn.tokens[1:]
+	return token
+}
+
+// scannerStack reads from the last pushed scanner until it ends, and then
+// goes back to the previous one.
+type scannerStack struct {
+	scanners []Scanner
+}
+
+func newScannerStack(base Scanner) *scannerStack {
+	return &scannerStack{[]Scanner{base}}
+}
+
+func (stack *scannerStack) push(scn Scanner) {
+	stack.scanners = append(stack.scanners, scn)
+}
+
+func (stack *scannerStack) Scan() Token {
+	for {
+		last := len(stack.scanners) - 1
+		token := stack.scanners[last].Scan()
+		if !token.IsType(TokenEof) || last == 0 {
+			return token
+		}
+		stack.scanners = stack.scanners[:last]
+	}
 }
@@ -0,0 +1,59 @@
+package tisasm
+
+import "sort"
+
+// region is memory written by the loader: a data entry or a segment.
+type region struct {
+	start int
+	size  int
+	token Token
+}
+
+func (reg region) end() int {
+	return reg.start + reg.size
+}
+
+// emitCodeSection starts a new segment at the origin written after .code.
+func (prs *Parser) emitCodeSection(section Token) {
+	origin := uint16(prs.immediateValue(prs.scan(), 2))
+	prs.program.Segments = append(prs.program.Segments, Segment{Origin: origin, Token: section})
+}
+
+// checkCode reports a program without code, since a ROM always ends with
+// a code section. It is reported at the end of the file.
+func (prs *Parser) checkCode() {
+	if len(prs.program.Segments) == 0 {
+		prs.diags = append(prs.diags, newTokenDiagnostic(prs.last, "Expected a .code section, the program has no code"))
+	}
+}
+
+func (prs *Parser) segment() *Segment {
+	return &prs.program.Segments[len(prs.program.Segments)-1]
+}
+
+// checkOverlaps reports memory written by more than one segment or data
+// entry, since the loader would overwrite one with the other.
+func (prs *Parser) checkOverlaps() {
+	regions := append([]region{}, prs.regions...)
+	for _, segment := range prs.program.Segments {
+		regions = append(regions, region{int(segment.Origin), len(segment.Code), segment.Token})
+	}
+	sort.SliceStable(regions, func(i, j int) bool {
+		return regions[i].start < regions[j].start
+	})
+	var last *region
+	for i := range regions {
+		current := &regions[i]
+		if current.size == 0 {
+			continue
+		}
+		if last != nil && current.start < last.end() {
+			diag := newTokenDiagnostic(current.token, "Memory $%04x-$%04x overlaps with memory already used", current.start, current.end()-1)
+			diag.Notes = append(diag.Notes, newNote(last.token, "Memory $%04x-$%04x is used here", last.start, last.end()-1))
+			prs.diags = append(prs.diags, diag)
+		}
+		if last == nil || current.end() > last.end() {
+			last = current
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package tisasm
+
+import "testing"
+
+func TestOverlaps(t *testing.T) {
+	tests := []struct {
+		source  string
+		message string
+		note    string
+	}{
+		{".data\n$5000 \"hi\"\n$5002 7\n", "Memory $5002-$5002 overlaps with memory already used", "Memory $5000-$5002 is used here"},
+		{".data\n$5000 \"\"\n$5000 7\n", "Memory $5000-$5000 overlaps with memory already used", "Memory $5000-$5000 is used here"},
+		{".data\n$5000 .fill 4, 1\n$5003 \"x\"\n", "Memory $5003-$5004 overlaps with memory already used", "Memory $5000-$5003 is used here"},
+		{".data\n$0200 \"ab\"\n.code $0202\nhlt\n", "Memory $0202-$0202 overlaps with memory already used", "Memory $0200-$0202 is used here"},
+	}
+	for _, test := range tests {
+		_, diags := assembleSource(t, test.source)
+		if len(diags) == 0 || diags[0].Message != test.message {
+			t.Errorf("%q: got %v, want error %q", test.source, diags, test.message)
+			continue
+		}
+		if notes := diags[0].Notes; len(notes) != 1 || notes[0].Message != test.note {
+			t.Errorf("%q: got notes %v, want %q", test.source, notes, test.note)
+		}
+	}
+}
+
+func TestNoOverlaps(t *testing.T) {
+	sources := []string{
+		".data\n$5000 \"hi\"\n$5003 7\n.code $0200\nhlt\n",
+		".data\n$5000 7\n$5001 \"\"\n$5002 8\n.code $0200\nhlt\n",
+		".data\n$0200 \"a\"\n.code $0202\nhlt\n",
+	}
+	for _, source := range sources {
+		if _, diags := assembleSource(t, source); len(diags) > 0 {
+			t.Errorf("%q: unexpected diagnostics %v", source, diags)
+		}
+	}
+}
+
+func TestProgramWithoutCode(t *testing.T) {
+	sources := []string{"", "; nothing\n", ".data\n$5000 \"hi\"\n", ".equ A 1\n"}
+	for _, source := range sources {
+		_, diags := assembleSource(t, source)
+		if len(diags) != 1 || diags[0].Message != "Expected a .code section, the program has no code" {
+			t.Errorf("%q: got %v, want an error for the missing code", source, diags)
+		}
+	}
+}
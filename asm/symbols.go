@@ -0,0 +1,106 @@
+package tisasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// symbolsHeader starts every symbol file, so readers can tell its format.
+const symbolsHeader = "; tisasm symbols 1"
+
+// WriteSymbols writes the symbol file of the program, sorted by value and
+// name. After the header comments, each line is a symbol with these fields
+// separated by tabs:
+//
+//	value  hexadecimal, four digits
+//	kind   label, data, constant or register
+//	name   as written in the source; local tags as global.local
+//	file   where it is defined, <command line> for -D
+//	line   where it is defined, 0 for -D
+//
+// Anonymous tags are left out, since their names cannot be written.
+func (program *Program) WriteSymbols(out io.Writer) error {
+	writer := bufio.NewWriter(out)
+	fmt.Fprintln(writer, symbolsHeader)
+	fmt.Fprintln(writer, "; value\tkind\tname\tfile\tline")
+	for _, symbol := range program.sortedSymbols() {
+		fmt.Fprintf(writer, "%04x\t%s\t%s\t%s\t%d\n", symbol.Value, symbol.Kind, symbol.Name, symbol.Token.File, symbol.Token.Line)
+	}
+	return writer.Flush()
+}
+
+// sortedSymbols returns the symbols sorted by value and name, without
+// the anonymous tags.
+func (program *Program) sortedSymbols() []Symbol {
+	symbols := make([]Symbol, 0, len(program.Symbols))
+	for name, symbol := range program.Symbols {
+		if !strings.HasPrefix(name, anonymousPrefix) {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if symbols[i].Value != symbols[j].Value {
+			return symbols[i].Value < symbols[j].Value
+		}
+		return symbols[i].Name < symbols[j].Name
+	})
+	return symbols
+}
+
+// ReadSymbols reads a symbol file written by WriteSymbols. The token of
+// each symbol only has its name, file and line.
+func ReadSymbols(name string, in io.Reader) ([]Symbol, error) {
+	scanner := bufio.NewScanner(in)
+	if !scanner.Scan() || scanner.Text() != symbolsHeader {
+		return nil, newDiagnostic(name, "Expected symbol file to start with '%s'", symbolsHeader)
+	}
+	symbols := []Symbol{}
+	for line := 2; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, ";") {
+			continue
+		}
+		symbol, err := parseSymbol(text)
+		if err != nil {
+			diag := newDiagnostic(name, "%s", err)
+			diag.Line = line
+			return nil, diag
+		}
+		symbols = append(symbols, symbol)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, newDiagnostic(name, "%s", err)
+	}
+	return symbols, nil
+}
+
+func parseSymbol(text string) (Symbol, error) {
+	fields := strings.Split(text, "\t")
+	if len(fields) != 5 {
+		return Symbol{}, fmt.Errorf("Expected 5 fields separated by tabs, but there are %d", len(fields))
+	}
+	value, err := strconv.ParseUint(fields[0], 16, 16)
+	if err != nil {
+		return Symbol{}, fmt.Errorf("Expected hexadecimal value under $10000, but found %s", fields[0])
+	}
+	kind := SymbolKind(fields[1])
+	switch kind {
+	case SymbolLabel, SymbolData, SymbolConstant, SymbolRegister:
+	default:
+		return Symbol{}, fmt.Errorf("Unknown symbol kind %s", fields[1])
+	}
+	line, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return Symbol{}, fmt.Errorf("Expected line number, but found %s", fields[4])
+	}
+	return Symbol{
+		Name:  fields[2],
+		Kind:  kind,
+		Value: uint16(value),
+		Token: Token{File: fields[3], Line: line, Literal: fields[2]},
+	}, nil
+}
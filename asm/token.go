@@ -8,7 +8,20 @@ import (
 type Token struct {
 	TokenType TokenType
 	Literal   string
+	File      string
 	Line      int
+	Column    int
+	Offset    int
+	Length    int
+	Expansion *Expansion
+	// IncludedFrom is the .include directive that read the token's file
+	IncludedFrom *Token
+}
+
+// Expansion tells which macro call produced a token.
+type Expansion struct {
+	Macro string
+	Call  Token
 }
 
 type TokenType string
@@ -19,9 +32,15 @@ const (
 	TokenChar        TokenType = "TokenChar"
 	TokenMemory      TokenType = "TokenMemory"
 	TokenSection     TokenType = "TokenSection"
+	TokenDirective   TokenType = "TokenDirective"
 	TokenNumber      TokenType = "TokenNumber"
 	TokenHex         TokenType = "TokenHex"
+	TokenBinary      TokenType = "TokenBinary"
 	TokenString      TokenType = "TokenString"
+	TokenComma       TokenType = "TokenComma"
+	TokenOperator    TokenType = "TokenOperator"
+	TokenLeftParen   TokenType = "TokenLeftParen"
+	TokenRightParen  TokenType = "TokenRightParen"
 	TokenInstruction TokenType = "TokenInstruction"
 	TokenError       TokenType = "TokenError"
 	TokenEof         TokenType = "TokenEof"
@@ -48,18 +67,22 @@ func (token Token) IsAnyTypeOf(tokenType ...TokenType) bool {
 	return false
 }
 
-func (token Token) AsInstruction() Instruction {
+func (token Token) AsInstruction() (Instruction, error) {
 	if !token.IsType(TokenInstruction) {
 		panic("Getting instruction size of something that is not an instruction")
 	}
 	lowerCase := strings.ToLower(token.Literal)
-	instruction, err := GetInstruction(lowerCase)
-	if err != nil {
-		ShowErrorTokenf(token, "Getting instruction size of undefined instruction: '%s',", token.Literal)
-	}
-	return instruction
+	return GetInstruction(lowerCase)
 }
 
 func (token Token) String() string {
-	return fmt.Sprintf("[%s] '%s' at line %d\n", token.TokenType, token.Literal, token.Line)
+	return fmt.Sprintf("[%s] '%s' at %d:%d\n", token.TokenType, token.Literal, token.Line, token.Column)
+}
+
+// position tells where the token was written, as file:line.
+func (token Token) position() string {
+	if token.Line == 0 {
+		return token.File
+	}
+	return fmt.Sprintf("%s:%d", token.File, token.Line)
 }
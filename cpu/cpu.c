@@ -4,47 +4,10 @@
 #include "cpu.h"
 #include "loader.h"
 #include "error.h"
+#include "opcodes.h"
 
 #define UINT8_COUNT (UINT8_MAX + 1)
 
-#define OP_ADD	0x01
-#define OP_ADDI 0x02
-#define OP_SUB	0x03
-#define OP_SUBI 0x04
-#define OP_SIL	0x05
-#define OP_SIR	0x06
-#define OP_AND	0x07
-#define OP_OR	0x08
-#define OP_XOR	0x09
-#define OP_NOT	0x0a
-#define OP_JMP	0x20
-#define OP_JEQ	0x21
-#define OP_JNE	0x22
-#define OP_JGT	0x23
-#define OP_JLT	0x24
-#define OP_JFG	0x25
-#define OP_LDR	0x30
-#define OP_STR	0x31
-#define OP_MOV	0x32
-#define OP_MOVI	0x33
-#define OP_TAR	0x34
-#define OP_TRA	0x35
-#define OP_INR	0x36
-#define OP_INW	0x37
-#define OP_DSK	0x38
-#define OP_MOVM 0x39
-#define OP_INT	0x40
-#define OP_HLT	0x41
-#define OP_CLL	0x42
-#define OP_CRN 	0x43
-#define OP_PMD 	0x44
-#define OP_EIN 	0x45
-#define OP_DIN	0x46
-#define OP_CFG	0x47
-#define OP_PSA	0x50
-#define OP_POA	0x51
-#define OP_PSR	0x52
-#define OP_POR	0x53
 
 static void set_flag(uint8_t code);
 static void call_subrutine(uint16_t direction);
@@ -5,10 +5,16 @@
 
 #define DATA_SECTION 0x00
 #define CODE_SECTION 0x01
+#define SIZED_CODE_SECTION 0x02
+// Sections from this one on are not loaded, like the debug info. They
+// start with their size in four bytes, so they can be skipped.
+#define FIRST_EXTRA_SECTION 0x03
 
 #define END_DATA_TYPE 0x00
 #define NUMBER_TYPE 0x02
 #define STRING_TYPE 0x01
+#define BLOCK_TYPE 0x03
+#define FILL_TYPE 0x04
 
 #define END_STRING 0x00
 
@@ -16,7 +22,11 @@ static void expect_section_header();
 static void expect_byte(uint8_t byte);
 static void read_data_section();
 static void read_code_section();
+static void read_sized_code_section();
+static void skip_extra_section();
 static void read_string(uint16_t direction);
+static void read_block(uint16_t direction);
+static void read_fill(uint16_t direction);
 static bool read_data_type(uint16_t direction);
 static uint16_t read_memory();
 
@@ -40,19 +50,32 @@ TisErr load_rom(const char* rom_name) {
 	if(!loader.reader.open(rom_name)) {
 		return ErrRomRead;
 	}
-	expect_section_header();
-	if(have_error()) {
-		loader.reader.close();
-		return loader.error;
-	}
-	switch(loader.reader.read()) {
-	case DATA_SECTION:
-		read_data_section();
-	case CODE_SECTION:
-		read_code_section();
-	default:
-		loader.error = ErrRomFormat;
-	}
+	// A ROM is a list of sections. Only the last one can be
+	// a code section without size, that takes the rest of the file.
+	do {
+		expect_section_header();
+		if(have_error()) {
+			break;
+		}
+		uint8_t section = loader.reader.read();
+		switch(section) {
+		case DATA_SECTION:
+			read_data_section();
+			break;
+		case CODE_SECTION:
+			read_code_section();
+			break;
+		case SIZED_CODE_SECTION:
+			read_sized_code_section();
+			break;
+		default:
+			if(section >= FIRST_EXTRA_SECTION && !loader.reader.is_at_end()) {
+				skip_extra_section();
+			} else {
+				loader.error = ErrRomFormat;
+			}
+		}
+	} while(!have_error() && !loader.reader.is_at_end());
 	loader.reader.close();
 	init_loader(loader.reader);
 	return loader.error;
@@ -65,15 +88,10 @@ static void read_data_section() {
 		}
 		uint16_t direction = read_memory();
 		if(!read_data_type(direction)) {
-			break;
+			return;
 		}
 	}
-	expect_section_header();
-	expect_byte(CODE_SECTION);
-	if(have_error()) {
-		return;
-	}
-	read_code_section();
+	loader.error = ErrRomFormat;
 }
 
 static bool read_data_type(uint16_t direction) {
@@ -86,7 +104,14 @@ static bool read_data_type(uint16_t direction) {
 	case STRING_TYPE:
 		read_string(direction);
 		return true;
+	case BLOCK_TYPE:
+		read_block(direction);
+		return true;
+	case FILL_TYPE:
+		read_fill(direction);
+		return true;
 	default:
+		loader.error = ErrRomFormat;
 		return false;
 	}
 }
@@ -101,6 +126,25 @@ static void read_string(uint16_t direction) {
 	}
 }
 
+static void read_block(uint16_t direction) {
+	uint16_t size = read_memory();
+	for(uint16_t offset = 0; offset < size; offset++) {
+		if(loader.reader.is_at_end()) {
+			loader.error = ErrRomFormat;
+			return;
+		}
+		write_byte(direction+offset, loader.reader.read());
+	}
+}
+
+static void read_fill(uint16_t direction) {
+	uint16_t count = read_memory();
+	uint8_t value = loader.reader.read();
+	for(uint16_t offset = 0; offset < count; offset++) {
+		write_byte(direction+offset, value);
+	}
+}
+
 static void read_code_section() {
 	uint16_t start_code = read_memory();
 	uint16_t offset = 0;
@@ -111,6 +155,30 @@ static void read_code_section() {
 	}
 }
 
+static void read_sized_code_section() {
+	uint16_t start_code = read_memory();
+	uint16_t size = read_memory();
+	for(uint16_t offset = 0; offset < size; offset++) {
+		if(loader.reader.is_at_end()) {
+			loader.error = ErrRomFormat;
+			return;
+		}
+		write_byte(start_code+offset, loader.reader.read());
+	}
+}
+
+static void skip_extra_section() {
+	uint32_t size = (uint32_t)read_memory() << 16;
+	size |= read_memory();
+	for(uint32_t offset = 0; offset < size; offset++) {
+		if(loader.reader.is_at_end()) {
+			loader.error = ErrRomFormat;
+			return;
+		}
+		loader.reader.read();
+	}
+}
+
 static uint16_t read_memory() {
 	uint16_t high = (uint16_t)loader.reader.read();
 	uint16_t low = (uint16_t)loader.reader.read();
@@ -0,0 +1,54 @@
+// Code generated by isagen from asm/isa.txt. DO NOT EDIT.
+
+#ifndef tiscpu_opcodes_h
+#define tiscpu_opcodes_h
+
+// Aritmetico-Logicos 0x0 y 0x1
+#define OP_ADD	0x01	// Add register. acc + Rx -> acc
+#define OP_ADDI	0x02	// Add integer. acc + INT -> acc
+#define OP_SUB	0x03	// Substract register. acc - Rx -> acc
+#define OP_SUBI	0x04	// Substract integer. acc - INT -> acc
+#define OP_SIL	0x05	// Shift left. acc << 1 -> acc
+#define OP_SIR	0x06	// Shift right. acc >> 1 -> acc
+#define OP_AND	0x07	// And register. acc & Rx -> acc
+#define OP_OR	0x08	// Or register. acc | Rx -> acc
+#define OP_XOR	0x09	// eXclusive OR register. acc ^ Rx -> acc
+#define OP_NOT	0x0a	// Not. ~acc -> acc
+
+// Salto 0x2
+#define OP_JMP	0x20	// Inconditional jump
+#define OP_JEQ	0x21	// Jump equals. If acc == 0, jump to mem
+#define OP_JNE	0x22	// Jump not equal. If acc != 0, jump to mem
+#define OP_JGT	0x23	// Jump Greater Than. If acc > 0, jump to mem
+#define OP_JLT	0x24	// Jump Lower Than. If acc < 0, jump to mem
+#define OP_JFG	0x25	// Jump If flag is setted. If Flags[INT], jump to mem
+
+// Movimiento 0x3
+#define OP_LDR	0x30	// Load register. $mem -> Rx
+#define OP_STR	0x31	// Store register. Rx -> $mem
+#define OP_MOV	0x32	// Move. Rx -> Ry
+#define OP_MOVI	0x33	// Move Integer. INT -> Rx
+#define OP_TAR	0x34	// Translate ACC to Rx. acc -> Rx
+#define OP_TRA	0x35	// Translate Rx to ACC. Rx -> ACC
+#define OP_INR	0x36	// Read indirection. Reads the byte that points the memory stored in MEM
+#define OP_INW	0x37	// Write indirection. Writes the byte that points the memory stored in MEM
+#define OP_DSK	0x38	// Writes disk content into memory direction
+#define OP_MOVM	0x39	// Write two bytes into destiny direction and the next one
+
+// Llamadas 0x4
+#define OP_INT	0x40	// Call interruption
+#define OP_HLT	0x41	// Halt execution
+#define OP_CLL	0x42	// Call subrutine that starts from $mem
+#define OP_CRN	0x43	// Returns control to calling subrutine
+#define OP_PMD	0x44	// Enable protected mode
+#define OP_EIN	0x45	// Enable interruptions
+#define OP_DIN	0x46	// Disable interruptions
+#define OP_CFG	0x47	// Clear flag with number
+
+// Stack manipulation 0x5
+#define OP_PSA	0x50	// Push acc
+#define OP_POA	0x51	// Pop to acc
+#define OP_PSR	0x52	// Push register Rx
+#define OP_POR	0x53	// Pop to register Rx
+
+#endif
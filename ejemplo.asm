@@ -1,5 +1,5 @@
 .data
-$5000 "DONE!"
+:done_msg $5000 "DONE!"
 
 .code $4100
     movi 0x00 R1
@@ -11,7 +11,7 @@ $5000 "DONE!"
 
 :end
     cfg 0x00
-    movm $5000 $0100
+    movm done_msg $0100
 	movm $3000 $0102
 	int 4
 	crn
\ No newline at end of file
@@ -1,6 +1,8 @@
+.include "tis80.inc"
+
 .data
-$4100 "user.rom"
-$4120 "Fatal error: Stack overflow"
+:user_rom $4100 "user.rom"
+:stack_overflow_msg $4120 "Fatal error: Stack overflow"
 
 .code $0200
 	; Register all interruptions
@@ -10,9 +12,9 @@ $4120 "Fatal error: Stack overflow"
 	movm strcpy $0008
 
 	; Call user code stored in $4100
-	dsk $4100
+	dsk user_rom
 	pmd
-	cll $4100
+	cll USER_CODE
 	hlt
 
 ;;;;;;;;;;;;;;;;;;;;;;;;;;;;;;;;;
@@ -26,9 +28,9 @@ $4120 "Fatal error: Stack overflow"
 ;;;;;;;;;;;;;;;;;;;;;;;;;;;;;;;;;;;;;
 :stack_overflow_int
 	din
-	cfg 0x01
-	movm $4120 $0100
-	movm $3000 $0102
+	cfg FLAG_STACK_OVERFLOW
+	movm stack_overflow_msg PARAM0
+	movm VIDEO_MEM PARAM1
 	cll strcpy
 	hlt
 
@@ -46,60 +48,60 @@ $4120 "Fatal error: Stack overflow"
 	; Copies a string stored in indirection $0100 to the direction stored in $0102
 
 	; str source is stored in R0 R1 and $1000 $1001
-	ldr $0100 R0
+	ldr PARAM0 R0
 	ldr $0101 R1
 	str R0 $1000
 	str R1 $1001
 
 	; str destiny is stored in R2 R3 and $1002 $1003
-	ldr $0102 R2
+	ldr PARAM1 R2
 	ldr $0103 R3
 	str R2 $1002
 	str R3 $1003
 
 	; Iterate over str source until a 0x00 is readed
-:loop_strcpy
-	inr $1000 R5 						; if str[i] == 0 goto end_strcpy
+:.loop
+	inr $1000 R5 						; if str[i] == 0 goto .end
 	tra R5
-	jeq end_strcpy
+	jeq .end
 	inw R5 $1002						; else write str[i] to destiny[j]
 
 	tra R1								; i++
 	addi 1
-	jfg 0x00 origin_overflow_strcpy 	; if lower part of direction have an overflow, fixit
+	jfg FLAG_OVERFLOW .origin_overflow 	; if lower part of direction have an overflow, fixit
 	tar R1								; else store R1
 	str R1 $1001
 
-:origin_contiune_strcpy
+:.origin_continue
 	tra R3								; j++
 	addi 1
-	jfg 0x00 destiny_overflow_strcpy 	; if lower part of direction have an overflow, fixit
+	jfg FLAG_OVERFLOW .destiny_overflow 	; if lower part of direction have an overflow, fixit
 	tar R3
 	str R3 $1003
 
-:destiny_continue_strcpy
-	jmp loop_strcpy
+:.destiny_continue
+	jmp .loop
 
-:end_strcpy
+:.end
 	ein
 	crn
 
-:origin_overflow_strcpy					; fix overflow of the lower part of the memory (origin str)
-	cfg 0x00
+:.origin_overflow					; fix overflow of the lower part of the memory (origin str)
+	cfg FLAG_OVERFLOW
 	tra R0
 	addi 1
 	tar R0
 	str R0 $1000
 	movi 0x00 R1
 	str R1 $1001
-	jmp origin_contiune_strcpy
+	jmp .origin_continue
 
-:destiny_overflow_strcpy				; fix overflow of the lower part of the memory (destiny str)
-	cfg 0x00
+:.destiny_overflow				; fix overflow of the lower part of the memory (destiny str)
+	cfg FLAG_OVERFLOW
 	tra R2
 	addi 1
 	tar R2
 	str R2 $1002
 	movi 0x00 R3
 	str R3 $1003
-	jmp destiny_continue_strcpy
\ No newline at end of file
+	jmp .destiny_continue
\ No newline at end of file
@@ -1,6 +1,6 @@
 .data
-$4100 "user.rom"
-$4120 "Fatal error: Stack overflow"
+:user_rom $4100 "user.rom"
+:stack_overflow_msg $4120 "Fatal error: Stack overflow"
 
 .code $0200
 	; Register all interruptions
@@ -10,7 +10,7 @@ $4120 "Fatal error: Stack overflow"
 	movm strcpy $0008
 
 	; Call user code stored in $4100
-	dsk $4100
+	dsk user_rom
 	pmd
 	cll $4100
 	hlt
@@ -27,7 +27,7 @@ $4120 "Fatal error: Stack overflow"
 :stack_overflow_int
 	din
 	cfg 0x01
-	movm $4120 $0100
+	movm stack_overflow_msg $0100
 	movm $3000 $0102
 	cll strcpy
 	hlt
@@ -1,8 +1,10 @@
+.include "tis80.inc"
+
 .data
-$5000 "Bienvenido a esta demo del Tis80. Esta version grafica obtiene la memoria de video y la representa en esta pantalla."
+:welcome $5000 "Bienvenido a esta demo del Tis80. Esta version grafica obtiene la memoria de video y la representa en esta pantalla."
 
 .code $4100
-	movm $5000 $0100
-	movm $3000 $0102
+	movm welcome PARAM0
+	movm VIDEO_MEM PARAM1
 	int 4
 	crn
\ No newline at end of file